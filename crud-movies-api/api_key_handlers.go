@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// getAPIKeys lists every API key, without the keys themselves.
+func (s *server) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.store.ListAPIKeys(r.Context())
+	if err != nil {
+		log.Printf("Error fetching API keys: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// createAPIKey mints a key with the name, scopes and optional expires_at
+// in the body. The response is the only time the key is shown.
+func (s *server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"` // RFC 3339
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := APIKey{Name: body.Name, Scopes: body.Scopes, ExpiresAt: body.ExpiresAt}
+	if err := validateAPIKey(&key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if user, ok := userFromContext(r.Context()); ok {
+		key.CreatedBy = &user.ID
+	}
+
+	secret, prefix, hash, err := newAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key.Prefix = prefix
+	if err := s.store.CreateAPIKey(r.Context(), &key, hash); err != nil {
+		log.Printf("Error creating API key: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	key.Key = secret
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// deleteAPIKey revokes a key.
+func (s *server) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid API key id", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.DeleteAPIKey(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting API key: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "API key deleted successfully"})
+}
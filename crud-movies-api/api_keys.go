@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix starts every API key, telling it apart from a session
+// token in the Authorization header.
+const apiKeyPrefix = "mmk_"
+
+// Scopes an API key may hold, following routePolicy. Reads take
+// movies:read whatever they read; the changes an editor may make take
+// categories:write under /categories and movies:write elsewhere; and the
+// deletes, merges and cleanups only an admin may make take movies:admin.
+const (
+	scopeMoviesRead      = "movies:read"
+	scopeMoviesWrite     = "movies:write"
+	scopeCategoriesWrite = "categories:write"
+	scopeMoviesAdmin     = "movies:admin"
+)
+
+var apiKeyScopes = map[string]bool{
+	scopeMoviesRead: true, scopeMoviesWrite: true, scopeCategoriesWrite: true, scopeMoviesAdmin: true,
+}
+
+// APIKey lets a script call the API without logging in, limited to its
+// Scopes. Key is only set when the key is created.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"` // the start of Key
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  *int       `json:"created_by"` // nil once the user is deleted
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"` // nil for never
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// validateAPIKey checks the fields an admin sets on a new key and
+// normalizes its scopes.
+func validateAPIKey(k *APIKey) error {
+	k.Name = strings.TrimSpace(k.Name)
+	if k.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+
+	seen := make(map[string]bool)
+	scopes := []string{}
+	for _, scope := range k.Scopes {
+		if !apiKeyScopes[scope] {
+			return fmt.Errorf("unknown scope %q, expected one of %s, %s, %s or %s",
+				scope, scopeMoviesRead, scopeMoviesWrite, scopeCategoriesWrite, scopeMoviesAdmin)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	sort.Strings(scopes)
+	k.Scopes = scopes
+	return nil
+}
+
+// newAPIKey returns a random key, the prefix it is listed by and the hash
+// it is stored under.
+func newAPIKey() (key, prefix, hash string, err error) {
+	token, _, err := newToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + token
+	return key, key[:len(apiKeyPrefix)+6], tokenHash(key), nil
+}
+
+// requiredScope returns the scope the request's route takes, by the role
+// requiredRole gives it, or "" if API keys cannot use it at all, as with
+// accounts and administration.
+func requiredScope(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/auth/") || strings.HasPrefix(r.URL.Path, "/admin/") {
+		return ""
+	}
+	switch requiredRole(r) {
+	case "", roleViewer:
+		return scopeMoviesRead
+	case roleEditor:
+		if r.URL.Path == "/categories" || strings.HasPrefix(r.URL.Path, "/categories/") {
+			return scopeCategoriesWrite
+		}
+		return scopeMoviesWrite
+	default:
+		return scopeMoviesAdmin
+	}
+}
+
+// hasScope reports whether key holds scope.
+func hasScope(key APIKey, scope string) bool {
+	for _, s := range key.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func withAPIKey(ctx context.Context, key APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey, key)
+}
+
+// apiKeyFromContext returns the API key the request was authenticated
+// with, if any.
+func apiKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(APIKey)
+	return key, ok
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, tmpl, path string
+		want               string
+	}{
+		{"GET", "/movies", "/movies", scopeMoviesRead},
+		{"GET", "/categories", "/categories", scopeMoviesRead},
+		{"HEAD", "/movies/{id}", "/movies/7", scopeMoviesRead},
+		{"POST", "/movies", "/movies", scopeMoviesWrite},
+		{"PUT", "/tags/{id}", "/tags/3", scopeMoviesWrite},
+		{"POST", "/movies/{id}/relations", "/movies/7/relations", scopeMoviesWrite},
+		{"POST", "/categories", "/categories", scopeCategoriesWrite},
+		{"POST", "/categories/{id}/move", "/categories/1/move", scopeCategoriesWrite},
+		{"DELETE", "/movies/{id}", "/movies/7", scopeMoviesAdmin},
+		{"DELETE", "/categories/{id}", "/categories/1", scopeMoviesAdmin},
+		{"POST", "/categories/{id}/merge-into/{target}", "/categories/1/merge-into/2", scopeMoviesAdmin},
+		{"POST", "/categories/cleanup", "/categories/cleanup", scopeMoviesAdmin},
+		{"POST", "/directors/{id}/merge-into/{target}", "/directors/1/merge-into/2", scopeMoviesAdmin},
+		{"POST", "/unlisted", "/unlisted", scopeMoviesAdmin},
+		{"GET", "/auth/me", "/auth/me", ""},
+		{"POST", "/auth/login", "/auth/login", ""},
+		{"GET", "/admin/users", "/admin/users", ""},
+		{"POST", "/admin/api-keys", "/admin/api-keys", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			got := "unrouted"
+			router := mux.NewRouter()
+			router.HandleFunc(tt.tmpl, func(w http.ResponseWriter, r *http.Request) {
+				got = requiredScope(r)
+			}).Methods(tt.method)
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			if got != tt.want {
+				t.Errorf("requiredScope = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name string
+		key  APIKey
+		ok   bool
+	}{
+		{"valid", APIKey{Name: "importer", Scopes: []string{scopeMoviesWrite, scopeMoviesRead}}, true},
+		{"no name", APIKey{Name: " ", Scopes: []string{scopeMoviesRead}}, false},
+		{"no scopes", APIKey{Name: "importer"}, false},
+		{"unknown scope", APIKey{Name: "importer", Scopes: []string{"movies:delete"}}, false},
+		{"expired", APIKey{Name: "importer", Scopes: []string{scopeMoviesRead}, ExpiresAt: &past}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAPIKey(&tt.key)
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+
+	k := APIKey{Name: " importer ", Scopes: []string{scopeMoviesWrite, scopeMoviesRead, scopeMoviesWrite}}
+	if err := validateAPIKey(&k); err != nil {
+		t.Fatal(err)
+	}
+	if k.Name != "importer" || len(k.Scopes) != 2 || k.Scopes[0] != scopeMoviesRead {
+		t.Errorf("not normalized: %+v", k)
+	}
+}
+
+// createAPIKey mints a key through the API and returns it.
+func (ts *testServer) createAPIKey(token string, scopes ...string) APIKey {
+	ts.t.Helper()
+	var key APIKey
+	body := map[string]interface{}{"name": "test", "scopes": scopes}
+	ts.expect(ts.do("POST", "/admin/api-keys", token, body), http.StatusCreated, &key)
+	return key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+	movie := ts.createMovie(admin, testMovie("Alien", 1979))
+
+	reader := ts.createAPIKey(admin, scopeMoviesRead).Key
+	writer := ts.createAPIKey(admin, scopeMoviesWrite).Key
+	deleter := ts.createAPIKey(admin, scopeMoviesAdmin).Key
+
+	ts.expect(ts.do("GET", "/movies/"+movie.ID, reader, nil), http.StatusOK, nil)
+	ts.expect(ts.do("GET", "/movies", "mmk_not-a-key", nil), http.StatusUnauthorized, nil)
+
+	var denied AccessDenied
+	ts.expect(ts.do("POST", "/movies", reader, testMovie("Aliens", 1986)), http.StatusForbidden, &denied)
+	if denied.Reason != "insufficient_scope" || denied.RequiredScope != scopeMoviesWrite {
+		t.Errorf("403 body = %+v", denied)
+	}
+	ts.expect(ts.do("POST", "/movies", writer, testMovie("Aliens", 1986)), http.StatusOK, nil)
+	ts.expect(ts.do("POST", "/categories", writer, Category{Name: "Horror"}), http.StatusForbidden, nil)
+
+	// Writing is not deleting or merging.
+	ts.expect(ts.do("DELETE", "/movies/"+movie.ID, writer, nil), http.StatusForbidden, &denied)
+	if denied.Reason != "insufficient_scope" || denied.RequiredScope != scopeMoviesAdmin {
+		t.Errorf("403 body = %+v", denied)
+	}
+	ts.expect(ts.do("POST", "/categories/cleanup", writer, nil), http.StatusForbidden, nil)
+	ts.expect(ts.do("DELETE", "/movies/"+movie.ID, deleter, nil), http.StatusOK, nil)
+
+	ts.expect(ts.do("GET", "/admin/api-keys", deleter, nil), http.StatusForbidden, &denied)
+	if denied.Reason != "api_key_not_allowed" {
+		t.Errorf("403 body = %+v", denied)
+	}
+	ts.expect(ts.do("GET", "/auth/me", reader, nil), http.StatusForbidden, nil)
+}
+
+func TestAPIKeyOwnerRole(t *testing.T) {
+	ts := newTestServer(t)
+	root := ts.login("root", roleAdmin)
+	admin := ts.login("admin", roleAdmin)
+	adminID := strconv.Itoa(ts.me(admin).ID)
+
+	key := ts.createAPIKey(admin, scopeMoviesRead, scopeMoviesWrite, scopeMoviesAdmin).Key
+	a := ts.createMovie(key, testMovie("Alien", 1979))
+	b := ts.createMovie(key, testMovie("Aliens", 1986))
+	ts.expect(ts.do("DELETE", "/movies/"+a.ID, key, nil), http.StatusOK, nil)
+
+	// Demoted to editor, the owner's key can still write but not delete.
+	ts.expect(ts.do("POST", "/admin/users/"+adminID+"/roles", root, map[string]string{"role": roleEditor}), http.StatusOK, nil)
+	ts.expect(ts.do("DELETE", "/admin/users/"+adminID+"/roles/"+roleAdmin, root, nil), http.StatusOK, nil)
+	var denied AccessDenied
+	ts.expect(ts.do("DELETE", "/movies/"+b.ID, key, nil), http.StatusForbidden, &denied)
+	if denied.Reason != "insufficient_role" || denied.RequiredRole != roleAdmin {
+		t.Errorf("403 body = %+v", denied)
+	}
+	ts.expect(ts.do("PUT", "/movies/"+b.ID, key, testMovie("Aliens", 1986)), http.StatusOK, nil)
+
+	// A viewer's key can only read.
+	ts.expect(ts.do("DELETE", "/admin/users/"+adminID+"/roles/"+roleEditor, root, nil), http.StatusOK, nil)
+	ts.expect(ts.do("PUT", "/movies/"+b.ID, key, testMovie("Aliens", 1986)), http.StatusForbidden, nil)
+	ts.expect(ts.do("GET", "/movies/"+b.ID, key, nil), http.StatusOK, nil)
+
+	// So can a key whose owner is unknown.
+	orphan := APIKey{Name: "orphan", Scopes: []string{scopeMoviesRead, scopeMoviesWrite}}
+	secret, prefix, hash, err := newAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan.Prefix = prefix
+	if err := ts.store.CreateAPIKey(context.Background(), &orphan, hash); err != nil {
+		t.Fatal(err)
+	}
+	ts.expect(ts.do("PUT", "/movies/"+b.ID, secret, testMovie("Aliens", 1986)), http.StatusForbidden, nil)
+	ts.expect(ts.do("GET", "/movies/"+b.ID, secret, nil), http.StatusOK, nil)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultSessionTTL is how long a login lasts unless SESSION_TTL says
+// otherwise.
+const defaultSessionTTL = 24 * time.Hour
+
+// Bounds on credentials. bcrypt ignores anything past 72 bytes, so longer
+// passwords are refused rather than silently truncated.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,50}$`)
+
+// User is an account. Its password hash never leaves the store.
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	// Roles are those granted, by sortRoles; every user is also a viewer.
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Credentials is the body of a registration or login.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// validateCredentials checks a new account's username and password.
+func validateCredentials(c *Credentials) error {
+	c.Username = strings.TrimSpace(c.Username)
+	if !usernamePattern.MatchString(c.Username) {
+		return fmt.Errorf("username must be 3 to 50 letters, digits, '.', '_' or '-'")
+	}
+	if len(c.Password) < minPasswordLength || len(c.Password) > maxPasswordLength {
+		return fmt.Errorf("password must be %d to %d bytes long", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
+
+// bootstrapAdmin creates the account username with password and makes it
+// an admin, so that a fresh install has someone who can grant roles. An
+// existing admin is left as is. Any other existing account is refused
+// rather than promoted, as anyone could have registered it.
+func bootstrapAdmin(ctx context.Context, store UserStore, username, password string) (User, error) {
+	user, _, err := store.UserByName(ctx, username)
+	if err == nil {
+		if !hasRole(user, roleAdmin) {
+			return User{}, fmt.Errorf("account %q already exists and is not an admin; refusing to promote it", username)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return User{}, err
+	}
+	if user, err = createUser(ctx, store, Credentials{Username: username, Password: password}); err != nil {
+		return User{}, err
+	}
+	return store.GrantRole(ctx, user.ID, roleAdmin)
+}
+
+// createUser validates c and stores a new account with its password.
+func createUser(ctx context.Context, store UserStore, c Credentials) (User, error) {
+	if err := validateCredentials(&c); err != nil {
+		return User{}, err
+	}
+	hash, err := hashPassword(c.Password)
+	if err != nil {
+		return User{}, err
+	}
+	user := User{Username: c.Username}
+	err = store.CreateUser(ctx, &user, hash)
+	return user, err
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// dummyPasswordHash is checked against when a login names no account, so
+// that the response takes as long as for a wrong password.
+var dummyPasswordHash, _ = hashPassword("not the password of anyone")
+
+// checkPassword reports whether password matches hash, or compares it
+// against dummyPasswordHash when hash is empty and reports false.
+func checkPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// newToken returns a random token for the client and the hash it is
+// stored under.
+func newToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, tokenHash(token), nil
+}
+
+// tokenHash is the form tokens are stored and looked up in, so that a
+// leaked database does not leak usable tokens.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or
+// "" if there is none.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	apiKeyContextKey
+)
+
+func withUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// userFromContext returns the user the request was authenticated as, if
+// any.
+func userFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userContextKey).(User)
+	return user, ok
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// authenticate attaches the user of the request's bearer session token
+// or OIDC access token, or the API key it bears instead, to its context.
+// Requests without a token go through anonymously; those with an invalid
+// or expired one are refused.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(token, apiKeyPrefix) {
+			key, err := s.store.UseAPIKey(r.Context(), tokenHash(token))
+			if errors.Is(err, ErrNotFound) {
+				unauthorized(w, "Invalid or expired API key")
+				return
+			}
+			if err != nil {
+				log.Printf("Error looking up API key: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withAPIKey(r.Context(), key)))
+			return
+		}
+
+		if s.oidc != nil && isJWT(token) {
+			verified, err := s.oidc.accessTokens.Verify(r.Context(), token)
+			if err != nil {
+				unauthorized(w, "Invalid or expired access token")
+				return
+			}
+			user, err := s.oidc.user(r.Context(), s.store, verified)
+			if errors.Is(err, ErrConflict) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				log.Printf("Error looking up OIDC user: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+			return
+		}
+
+		user, err := s.store.SessionUser(r.Context(), tokenHash(token))
+		if errors.Is(err, ErrNotFound) {
+			unauthorized(w, "Invalid or expired session")
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up session: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+	})
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+func (s *server) register(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCredentials(&creds); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := hashPassword(creds.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := User{Username: creds.Username}
+	err = s.store.CreateUser(r.Context(), &user, hash)
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// login starts a session for valid credentials. The token it returns is
+// sent back as "Authorization: Bearer <token>" until it expires or the
+// client logs out.
+func (s *server) login(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, hash, err := s.store.UserByName(r.Context(), creds.Username)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !checkPassword(hash, creds.Password) {
+		unauthorized(w, "Invalid username or password")
+		return
+	}
+	s.startSession(w, r, user)
+}
+
+// startSession logs user in and responds with the session token.
+func (s *server) startSession(w http.ResponseWriter, r *http.Request, user User) {
+	token, hashed, err := newToken()
+	if err != nil {
+		log.Printf("Error generating session token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(s.sessionTTL)
+	if err := s.store.CreateSession(r.Context(), user.ID, hashed, expiresAt); err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":      token,
+		"expires_at": expiresAt,
+		"user":       user,
+	})
+}
+
+// logout ends the session the request was made with.
+func (s *server) logout(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteSession(r.Context(), tokenHash(bearerToken(r))); err != nil {
+		log.Printf("Error deleting session: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// me returns the user the request is authenticated as.
+func (s *server) me(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	writeJSON(w, http.StatusOK, user)
+}
+
+// getUsers lists every user with their roles.
+func (s *server) getUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.ListUsers(r.Context())
+	if err != nil {
+		log.Printf("Error fetching users: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// grantRole gives user {id} the role named in the body.
+func (s *server) grantRole(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !grantableRole(body.Role) {
+		http.Error(w, fmt.Sprintf("role must be %s or %s", roleEditor, roleAdmin), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.store.GrantRole(r.Context(), id, body.Role)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error granting role %s to user %d: %v", body.Role, id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// revokeRole takes role {role} from user {id}. The last admin cannot lose
+// the role, or no one could grant it again.
+func (s *server) revokeRole(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+	role := mux.Vars(r)["role"]
+	if !grantableRole(role) {
+		http.Error(w, fmt.Sprintf("role must be %s or %s", roleEditor, roleAdmin), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.store.RevokeRole(r.Context(), id, role)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking role %s from user %d: %v", role, id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
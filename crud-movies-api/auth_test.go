@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// session is the body of a successful login.
+type session struct {
+	Token string `json:"token"`
+	User  User   `json:"user"`
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	ts := newTestServer(t)
+	creds := Credentials{Username: "ripley", Password: "nostromo"}
+
+	var user User
+	ts.expect(ts.do("POST", "/auth/register", "", creds), http.StatusCreated, &user)
+	if user.Username != "ripley" || len(user.Roles) != 0 {
+		t.Errorf("registered %+v; the first user must not be an admin", user)
+	}
+	ts.expect(ts.do("POST", "/auth/register", "", Credentials{Username: "RIPLEY", Password: "nostromo"}), http.StatusConflict, nil)
+	ts.expect(ts.do("POST", "/auth/register", "", Credentials{Username: "ash", Password: "short"}), http.StatusBadRequest, nil)
+
+	ts.expect(ts.do("POST", "/auth/login", "", Credentials{Username: "ripley", Password: "wrong password"}), http.StatusUnauthorized, nil)
+	ts.expect(ts.do("POST", "/auth/login", "", Credentials{Username: "nobody", Password: "nostromo"}), http.StatusUnauthorized, nil)
+
+	var s session
+	ts.expect(ts.do("POST", "/auth/login", "", creds), http.StatusOK, &s)
+	if s.Token == "" || s.User.ID != user.ID {
+		t.Fatalf("login returned %+v", s)
+	}
+	if me := ts.me(s.Token); me.ID != user.ID {
+		t.Errorf("me = %+v", me)
+	}
+	ts.expect(ts.do("POST", "/movies", s.Token, testMovie("Alien", 1979)), http.StatusForbidden, nil)
+
+	ts.expect(ts.do("POST", "/auth/logout", s.Token, nil), http.StatusOK, nil)
+	ts.expect(ts.do("GET", "/auth/me", s.Token, nil), http.StatusUnauthorized, nil)
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	if _, err := bootstrapAdmin(ctx, store, "root", "short"); err == nil {
+		t.Error("created an admin with an invalid password")
+	}
+
+	admin, err := bootstrapAdmin(ctx, store, "root", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(admin.Roles, []string{roleAdmin}) {
+		t.Errorf("roles = %q, want admin", admin.Roles)
+	}
+
+	// Running it again, as on every start, changes nothing.
+	again, err := bootstrapAdmin(ctx, store, "root", "another password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != admin.ID {
+		t.Errorf("second run returned user %d, want %d", again.ID, admin.ID)
+	}
+	_, hash, err := store.UserByName(ctx, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkPassword(hash, "correct horse") {
+		t.Error("the existing admin's password was changed")
+	}
+
+	// An existing account that is not an admin, which anyone could have
+	// registered, is refused rather than promoted.
+	user := User{Username: "ripley"}
+	if err := store.CreateUser(ctx, &user, "unused"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bootstrapAdmin(ctx, store, "Ripley", "correct horse"); err == nil {
+		t.Error("promoted an existing account")
+	}
+	if got, err := store.GetUser(ctx, user.ID); err != nil || len(got.Roles) != 0 {
+		t.Errorf("ripley = %+v, %v; want no roles", got, err)
+	}
+}
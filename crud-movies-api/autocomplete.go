@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultAutocompleteLimit = 5
+	maxAutocompleteLimit     = 20
+)
+
+// autocompleteTypes are the entity types /autocomplete can return.
+var autocompleteTypes = []string{"movie", "director", "category"}
+
+// AutocompleteItem is one typeahead suggestion.
+type AutocompleteItem struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// Year is set for movies; Count, the number of movies, for directors
+	// and categories.
+	Year  int `json:"year,omitempty"`
+	Count int `json:"count,omitempty"`
+}
+
+// Autocompletion maps each requested type to its suggestions.
+type Autocompletion map[string][]AutocompleteItem
+
+// AutocompleteRequest selects the suggestions to return: at most Limit per
+// type whose name, or a word in it, starts with Prefix.
+type AutocompleteRequest struct {
+	Prefix string
+	Types  map[string]bool
+	Limit  int
+}
+
+// likePrefix escapes s for use at the start of a LIKE pattern.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// wordPrefixMatch reports whether name, or one of its words, starts with
+// prefix, ignoring case. It mirrors the LIKE patterns the Postgres store
+// uses.
+func wordPrefixMatch(name, prefix string) bool {
+	name, prefix = strings.ToLower(name), strings.ToLower(prefix)
+	return strings.HasPrefix(name, prefix) || strings.Contains(name, " "+prefix)
+}
+
+func (s *server) autocomplete(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := AutocompleteRequest{
+		Prefix: strings.TrimSpace(q.Get("q")),
+		Types:  make(map[string]bool),
+		Limit:  defaultAutocompleteLimit,
+	}
+	if req.Prefix == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	if v := q.Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			known := false
+			for _, k := range autocompleteTypes {
+				known = known || k == t
+			}
+			if !known {
+				http.Error(w, "unknown type "+strconv.Quote(t), http.StatusBadRequest)
+				return
+			}
+			req.Types[t] = true
+		}
+	} else {
+		for _, t := range autocompleteTypes {
+			req.Types[t] = true
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAutocompleteLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxAutocompleteLimit), http.StatusBadRequest)
+			return
+		}
+		req.Limit = n
+	}
+
+	result, err := s.store.Autocomplete(r.Context(), req)
+	if err != nil {
+		log.Printf("Error fetching autocomplete suggestions: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestWordPrefixMatch(t *testing.T) {
+	tests := []struct {
+		name, prefix string
+		want         bool
+	}{
+		{"Star Wars", "star", true},
+		{"A Star Is Born", "STAR", true},
+		{"The Last Starfighter", "starf", true},
+		{"Mustard", "star", false},
+		{"Star Wars", "wars x", false},
+	}
+	for _, tt := range tests {
+		if got := wordPrefixMatch(tt.name, tt.prefix); got != tt.want {
+			t.Errorf("wordPrefixMatch(%q, %q) = %v, want %v", tt.name, tt.prefix, got, tt.want)
+		}
+	}
+	if got, want := likePrefix(`50%_\`), `50\%\_\\%`; got != want {
+		t.Errorf("likePrefix = %q, want %q", got, want)
+	}
+}
+
+// labels returns the labels of items, in order.
+func labels(items []AutocompleteItem) []string {
+	labels := []string{}
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	return labels
+}
+
+func TestAutocomplete(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		for _, m := range []struct {
+			title    string
+			year     int
+			director Director
+			category string
+		}{
+			{"Star Wars", 1977, Director{Firstname: "George", Lastname: "Lucas"}, "Space Opera"},
+			{"THX 1138", 1971, Director{Firstname: "George", Lastname: "Lucas"}, "Dystopia"},
+			{"The Last Starfighter", 1984, Director{Firstname: "Nick", Lastname: "Castle"}, "Space Opera"},
+			{"A Star Is Born", 1976, Director{Firstname: "Frank", Lastname: "Pierson"}, "Drama"},
+			{"Mustard", 2001, Director{Firstname: "Lucy", Lastname: "Walker"}, "Drama"},
+		} {
+			movie := testMovie(m.title, m.year)
+			movie.Director = m.director
+			movie.Categories = []Category{{Name: m.category}}
+			ts.createMovie(admin, movie)
+		}
+		ts.createCategory(admin, Category{Name: "Starships"})
+
+		// Names starting with the prefix come first, then movies newest
+		// first and others by movie count.
+		var got Autocompletion
+		ts.expect(ts.do("GET", "/autocomplete?q=star", "", nil), http.StatusOK, &got)
+		want := map[string][]string{
+			"movie":    {"Star Wars", "A Star Is Born", "The Last Starfighter"},
+			"director": {},
+			"category": {"Starships"},
+		}
+		for kind, wantNames := range want {
+			if names := labels(got[kind]); !reflect.DeepEqual(names, wantNames) {
+				t.Errorf("%s = %q, want %q", kind, names, wantNames)
+			}
+		}
+		if movies := got["movie"]; len(movies) == 0 || movies[0].Year != 1977 {
+			t.Errorf("movies = %+v, want Star Wars' year", movies)
+		}
+
+		got = nil
+		ts.expect(ts.do("GET", "/autocomplete?q=luc&types=director", "", nil), http.StatusOK, &got)
+		if len(got) != 1 {
+			t.Errorf("types=director returned %+v", got)
+		}
+		directors := got["director"]
+		if names := labels(directors); !reflect.DeepEqual(names, []string{"Lucy Walker", "George Lucas"}) {
+			t.Errorf("directors = %q", names)
+		} else if directors[1].Count != 2 {
+			t.Errorf("George Lucas has count %d, want 2", directors[1].Count)
+		}
+
+		got = nil
+		ts.expect(ts.do("GET", "/autocomplete?q=s&types=movie,category&limit=1", "", nil), http.StatusOK, &got)
+		if len(got["movie"]) != 1 || len(got["category"]) != 1 {
+			t.Errorf("limit=1 returned %+v", got)
+		}
+
+		for _, query := range []string{"", "?q=%20", "?q=star&types=actor", "?q=star&limit=0", "?q=star&limit=21"} {
+			ts.expect(ts.do("GET", "/autocomplete"+query, "", nil), http.StatusBadRequest, nil)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxCategoryDescriptionLength = 1000
+	maxCategoryIconLength        = 64
+)
+
+// categoryColor matches Category.Color once lower-cased.
+var categoryColor = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+// validateCategory checks the fields a client sets on a category and
+// normalizes them.
+func validateCategory(category *Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	category.Description = strings.TrimSpace(category.Description)
+	if len([]rune(category.Description)) > maxCategoryDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxCategoryDescriptionLength)
+	}
+	category.Color = strings.ToLower(strings.TrimSpace(category.Color))
+	if category.Color != "" && !categoryColor.MatchString(category.Color) {
+		return fmt.Errorf("color must look like #1e90ff")
+	}
+	category.Icon = strings.TrimSpace(category.Icon)
+	if len([]rune(category.Icon)) > maxCategoryIconLength {
+		return fmt.Errorf("icon must be at most %d characters", maxCategoryIconLength)
+	}
+	return nil
+}
+
+// normalizeMovieCategories trims the names of the movie's categories and
+// drops those repeating an earlier one regardless of case, since a movie
+// is linked to each category once.
+func normalizeMovieCategories(movie *Movie) {
+	seen := make(map[string]bool)
+	categories := []Category{}
+	for _, c := range movie.Categories {
+		c.Name = strings.TrimSpace(c.Name)
+		if key := strings.ToLower(c.Name); !seen[key] {
+			seen[key] = true
+			categories = append(categories, c)
+		}
+	}
+	movie.Categories = categories
+}
+
+// categoryTree nests categories under their parents, keeping their order
+// among siblings. Categories whose parent is not among them are roots.
+func categoryTree(categories []Category) []Category {
+	present := make(map[int]bool, len(categories))
+	for _, c := range categories {
+		present[c.ID] = true
+	}
+
+	roots := []Category{}
+	children := make(map[int][]Category)
+	for _, c := range categories {
+		if c.ParentID != nil && present[*c.ParentID] {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+
+	var nest func(c Category) Category
+	nest = func(c Category) Category {
+		c.Children = nil
+		for _, child := range children[c.ID] {
+			c.Children = append(c.Children, nest(child))
+		}
+		return c
+	}
+	for i := range roots {
+		roots[i] = nest(roots[i])
+	}
+	return roots
+}
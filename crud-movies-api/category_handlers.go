@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// getCategories lists categories as a tree of roots with their children,
+// or with ?flat=true as a single list. Only categories with movies, or
+// with descendants that have some, are listed unless ?include_empty=true.
+func (s *server) getCategories(w http.ResponseWriter, r *http.Request) {
+	var flat, includeEmpty bool
+	for name, v := range map[string]*bool{"flat": &flat, "include_empty": &includeEmpty} {
+		if q := r.URL.Query().Get(name); q != "" {
+			b, err := strconv.ParseBool(q)
+			if err != nil {
+				http.Error(w, name+" must be true or false", http.StatusBadRequest)
+				return
+			}
+			*v = b
+		}
+	}
+
+	categories, err := s.store.ListCategories(r.Context(), includeEmpty)
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if flat {
+		if categories == nil {
+			categories = []Category{}
+		}
+		writeJSON(w, http.StatusOK, categories)
+		return
+	}
+	writeJSON(w, http.StatusOK, categoryTree(categories))
+}
+
+func (s *server) createCategory(w http.ResponseWriter, r *http.Request) {
+	var category Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCategory(&category); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if category.Rules != nil && category.ParentID != nil {
+		http.Error(w, "Smart categories cannot have a parent", http.StatusBadRequest)
+		return
+	}
+	if err := s.checkRules(r.Context(), category.Rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := s.store.CreateCategory(r.Context(), &category)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Parent category not found", http.StatusBadRequest)
+		return
+	}
+	var conflict *CategoryConflictError
+	if errors.As(err, &conflict) {
+		writeJSON(w, http.StatusConflict, conflict)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating category: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, category)
+}
+
+func (s *server) updateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid category id", http.StatusBadRequest)
+		return
+	}
+
+	var category Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCategory(&category); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if category.Rules != nil && category.ParentID != nil {
+		http.Error(w, "Smart categories cannot have a parent", http.StatusBadRequest)
+		return
+	}
+	if err := s.checkRules(r.Context(), category.Rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.UpdateCategory(r.Context(), id, &category)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	var conflict *CategoryConflictError
+	if errors.As(err, &conflict) {
+		writeJSON(w, http.StatusConflict, conflict)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating category: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, category)
+}
+
+// checkRules validates the rules of a smart category, if any, including
+// that the people and regular categories they name exist.
+func (s *server) checkRules(ctx context.Context, rules *CategoryRules) error {
+	if rules == nil {
+		return nil
+	}
+	if err := validateRules(rules); err != nil {
+		return err
+	}
+	for _, id := range []int{rules.DirectorID, rules.PersonID} {
+		if id == 0 {
+			continue
+		}
+		if _, err := s.store.GetDirector(ctx, id); errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("person %d not found", id)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range append(append([]int{}, rules.Categories...), rules.ExcludeCategories...) {
+		c, err := s.store.GetCategory(ctx, id)
+		if errors.Is(err, ErrNotFound) || err == nil && c.Rules != nil {
+			return fmt.Errorf("category %d not found or is a smart category", id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveCategory reparents category {id} under the category given as
+// parent_id in the body, or makes it a root when parent_id is null.
+func (s *server) moveCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid category id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		ParentID *int `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category, err := s.store.MoveCategory(r.Context(), id, body.ParentID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error moving category: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, category)
+}
+
+// mergeCategory folds category {id} into category {target}: the target
+// takes over its movies and children and {id} is deleted.
+func (s *server) mergeCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid category id", http.StatusBadRequest)
+		return
+	}
+	target, err := strconv.Atoi(mux.Vars(r)["target"])
+	if err != nil {
+		http.Error(w, "Invalid target category id", http.StatusBadRequest)
+		return
+	}
+	if id == target {
+		http.Error(w, "Cannot merge a category into itself", http.StatusBadRequest)
+		return
+	}
+
+	category, err := s.store.MergeCategories(r.Context(), id, target)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error merging category %d into %d: %v", id, target, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, category)
+}
+
+// deleteCategory deletes a category that no movie is in. With
+// ?reassign_to= its movies move to that category first, as in a merge;
+// with ?force=true they simply lose it.
+func (s *server) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid category id", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	force := false
+	if v := q.Get("force"); v != "" {
+		if force, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "force must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("reassign_to"); v != "" {
+		target, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid reassign_to category id", http.StatusBadRequest)
+			return
+		}
+		if force {
+			http.Error(w, "reassign_to and force cannot be combined", http.StatusBadRequest)
+			return
+		}
+		if target == id {
+			http.Error(w, "Cannot reassign a category's movies to itself", http.StatusBadRequest)
+			return
+		}
+		_, err = s.store.MergeCategories(r.Context(), id, target)
+	} else {
+		err = s.store.DeleteCategory(r.Context(), id, force)
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	var conflict *CategoryConflictError
+	if errors.As(err, &conflict) {
+		writeJSON(w, http.StatusConflict, conflict)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting category: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Category deleted successfully"})
+}
+
+func (s *server) getMoviesByCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid category id", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseListOptions(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := s.store.MoviesByCategory(r.Context(), id, opts)
+	if err != nil {
+		log.Printf("Error fetching movies by category: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeMoviePage(w, page)
+}
+
+// cleanupCategories deletes the categories without movies, except those
+// with descendants that have some.
+func (s *server) cleanupCategories(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.CleanupEmptyCategories(r.Context()); err != nil {
+		log.Printf("Error cleaning up empty categories: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Empty categories deleted successfully"})
+}
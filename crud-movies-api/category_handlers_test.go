@@ -0,0 +1,283 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// createCategory stores a category through the API and returns it.
+func (ts *testServer) createCategory(token string, category Category) Category {
+	ts.t.Helper()
+	var created Category
+	ts.expect(ts.do("POST", "/categories", token, category), http.StatusCreated, &created)
+	return created
+}
+
+// movieCategories returns the sorted names of movie id's categories.
+func (ts *testServer) movieCategories(id string) []string {
+	ts.t.Helper()
+	var movie Movie
+	ts.expect(ts.do("GET", "/movies/"+id, "", nil), http.StatusOK, &movie)
+	names := []string{}
+	for _, c := range movie.Categories {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// category returns category id as listed, empty or not, failing if it doesn't exist.
+func (ts *testServer) category(id int) Category {
+	ts.t.Helper()
+	var flat []Category
+	ts.expect(ts.do("GET", "/categories?flat=true&include_empty=true", "", nil), http.StatusOK, &flat)
+	for _, c := range flat {
+		if c.ID == id {
+			return c
+		}
+	}
+	ts.t.Fatalf("category %d not listed", id)
+	return Category{}
+}
+
+func categoryPath(id int, rest string) string {
+	return "/categories/" + strconv.Itoa(id) + rest
+}
+
+func TestMergeCategory(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	scifi := ts.createCategory(admin, Category{Name: "Sci-Fi"})
+	sf := ts.createCategory(admin, Category{Name: "SF"})
+	space := ts.createCategory(admin, Category{Name: "Space", ParentID: &sf.ID})
+
+	both := testMovie("Alien", 1979)
+	both.Categories = []Category{{Name: "Sci-Fi"}, {Name: "SF"}}
+	alien := ts.createMovie(admin, both)
+	only := testMovie("Blade Runner", 1982)
+	only.Categories = []Category{{Name: "SF"}}
+	bladeRunner := ts.createMovie(admin, only)
+
+	var into Category
+	ts.expect(ts.do("POST", categoryPath(sf.ID, "/merge-into/"+strconv.Itoa(scifi.ID)), admin, nil), http.StatusOK, &into)
+	if into.ID != scifi.ID {
+		t.Errorf("merge returned category %d, want %d", into.ID, scifi.ID)
+	}
+
+	for _, id := range []string{alien.ID, bladeRunner.ID} {
+		if got := ts.movieCategories(id); len(got) != 1 || got[0] != "Sci-Fi" {
+			t.Errorf("movie %s is in %q, want only Sci-Fi", id, got)
+		}
+	}
+	if p := ts.category(space.ID).ParentID; p == nil || *p != scifi.ID {
+		t.Errorf("Space's parent = %v, want %d", p, scifi.ID)
+	}
+	ts.expect(ts.do("POST", categoryPath(sf.ID, "/merge-into/"+strconv.Itoa(scifi.ID)), admin, nil), http.StatusNotFound, nil)
+}
+
+func TestMergeCategoryRejects(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	parent := ts.createCategory(admin, Category{Name: "Drama"})
+	child := ts.createCategory(admin, Category{Name: "Period Drama", ParentID: &parent.ID})
+
+	tests := []struct {
+		name     string
+		id, into int
+		status   int
+	}{
+		{"into itself", parent.ID, parent.ID, http.StatusBadRequest},
+		{"into its descendant", parent.ID, child.ID, http.StatusConflict},
+		{"missing target", parent.ID, 999, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.expect(ts.do("POST", categoryPath(tt.id, "/merge-into/"+strconv.Itoa(tt.into)), admin, nil), tt.status, nil)
+		})
+	}
+	ts.expect(ts.do("POST", categoryPath(parent.ID, "/merge-into/"+strconv.Itoa(parent.ID)), "", nil), http.StatusUnauthorized, nil)
+}
+
+func TestMovieCategoryNamesRepeated(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		movie := testMovie("Alien", 1979)
+		movie.Categories = []Category{{Name: "Sci-Fi"}, {Name: " sci-fi"}, {Name: "Horror"}, {Name: "Sci-Fi"}}
+		created := ts.createMovie(admin, movie)
+		if got := ts.movieCategories(created.ID); !reflect.DeepEqual(got, []string{"Horror", "Sci-Fi"}) {
+			t.Errorf("created movie is in %q, want Horror and Sci-Fi", got)
+		}
+
+		movie.Categories = []Category{{Name: "Horror"}, {Name: "HORROR"}}
+		ts.expect(ts.do("PUT", "/movies/"+created.ID, admin, movie), http.StatusOK, nil)
+		if got := ts.movieCategories(created.ID); !reflect.DeepEqual(got, []string{"Horror"}) {
+			t.Errorf("updated movie is in %q, want only Horror", got)
+		}
+	})
+}
+
+func TestDeleteCategory(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	parent := ts.createCategory(admin, Category{Name: "Thriller"})
+	noir := ts.createCategory(admin, Category{Name: "Noir", ParentID: &parent.ID})
+	neo := ts.createCategory(admin, Category{Name: "Neo-Noir", ParentID: &noir.ID})
+	crime := ts.createCategory(admin, Category{Name: "Crime"})
+	empty := ts.createCategory(admin, Category{Name: "Empty"})
+
+	m := testMovie("Chinatown", 1974)
+	m.Categories = []Category{{Name: "Noir"}}
+	chinatown := ts.createMovie(admin, m)
+
+	// A category with movies is kept, with a structured conflict.
+	var conflict CategoryConflictError
+	ts.expect(ts.do("DELETE", categoryPath(noir.ID, ""), admin, nil), http.StatusConflict, &conflict)
+	if conflict.Reason != "in_use" || conflict.CategoryID != noir.ID || conflict.Movies != 1 {
+		t.Errorf("conflict = %+v", conflict)
+	}
+
+	ts.expect(ts.do("DELETE", categoryPath(noir.ID, "?force=true&reassign_to="+strconv.Itoa(crime.ID)), admin, nil), http.StatusBadRequest, nil)
+	ts.expect(ts.do("DELETE", categoryPath(noir.ID, "?reassign_to="+strconv.Itoa(noir.ID)), admin, nil), http.StatusBadRequest, nil)
+	ts.expect(ts.do("DELETE", categoryPath(noir.ID, "?force=maybe"), admin, nil), http.StatusBadRequest, nil)
+
+	// reassign_to moves its movies and children, as a merge does.
+	ts.expect(ts.do("DELETE", categoryPath(noir.ID, "?reassign_to="+strconv.Itoa(crime.ID)), admin, nil), http.StatusOK, nil)
+	if got := ts.movieCategories(chinatown.ID); len(got) != 1 || got[0] != "Crime" {
+		t.Errorf("Chinatown is in %q, want only Crime", got)
+	}
+	if p := ts.category(neo.ID).ParentID; p == nil || *p != crime.ID {
+		t.Errorf("Neo-Noir's parent = %v, want %d", p, crime.ID)
+	}
+
+	// force takes the category off its movies and hands its children to
+	// its parent.
+	ts.expect(ts.do("PUT", categoryPath(neo.ID, ""), admin, Category{Name: "Neo-Noir", ParentID: &crime.ID}), http.StatusOK, nil)
+	sub := ts.createCategory(admin, Category{Name: "Heist", ParentID: &neo.ID})
+	m = testMovie("Heat", 1995)
+	m.Categories = []Category{{Name: "Neo-Noir"}}
+	heat := ts.createMovie(admin, m)
+	ts.expect(ts.do("DELETE", categoryPath(neo.ID, "?force=true"), admin, nil), http.StatusOK, nil)
+	if got := ts.movieCategories(heat.ID); len(got) != 0 {
+		t.Errorf("Heat is still in %q", got)
+	}
+	if p := ts.category(sub.ID).ParentID; p == nil || *p != crime.ID {
+		t.Errorf("Heist's parent = %v, want %d", p, crime.ID)
+	}
+
+	ts.expect(ts.do("DELETE", categoryPath(empty.ID, ""), admin, nil), http.StatusOK, nil)
+	ts.expect(ts.do("DELETE", categoryPath(empty.ID, ""), admin, nil), http.StatusNotFound, nil)
+
+	editor := ts.login("editor", roleEditor)
+	ts.expect(ts.do("DELETE", categoryPath(crime.ID, ""), editor, nil), http.StatusForbidden, nil)
+}
+
+func TestCleanupCategories(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	parent := ts.createCategory(admin, Category{Name: "Drama"})
+	ts.createCategory(admin, Category{Name: "War", ParentID: &parent.ID})
+	ts.createCategory(admin, Category{Name: "Unused"})
+	m := testMovie("Apocalypse Now", 1979)
+	m.Categories = []Category{{Name: "War"}}
+	ts.createMovie(admin, m)
+
+	ts.expect(ts.do("POST", "/categories/cleanup", admin, nil), http.StatusOK, nil)
+	var flat []Category
+	ts.expect(ts.do("GET", "/categories?flat=true&include_empty=true", "", nil), http.StatusOK, &flat)
+	var names []string
+	for _, c := range flat {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"Drama", "War"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("categories after cleanup = %q, want %q", names, want)
+	}
+}
+
+// titles returns the sorted titles of movies.
+func titles(movies []Movie) []string {
+	titles := []string{}
+	for _, m := range movies {
+		titles = append(titles, m.Title)
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func TestCategoryTree(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		drama := ts.createCategory(admin, Category{Name: "Drama"})
+		war := ts.createCategory(admin, Category{Name: "War", ParentID: &drama.ID})
+		vietnam := ts.createCategory(admin, Category{Name: "Vietnam", ParentID: &war.ID})
+		comedy := ts.createCategory(admin, Category{Name: "Comedy"})
+		for _, m := range []struct {
+			title    string
+			category string
+		}{
+			{"Platoon", "Vietnam"},
+			{"Ordinary People", "Drama"},
+		} {
+			movie := testMovie(m.title, 1980)
+			movie.Categories = []Category{{Name: m.category}}
+			ts.createMovie(admin, movie)
+		}
+
+		// The tree nests categories whose movies are all in subcategories.
+		var tree []Category
+		ts.expect(ts.do("GET", "/categories", "", nil), http.StatusOK, &tree)
+		if len(tree) != 1 || tree[0].ID != drama.ID || len(tree[0].Children) != 1 ||
+			tree[0].Children[0].ID != war.ID || len(tree[0].Children[0].Children) != 1 ||
+			tree[0].Children[0].Children[0].ID != vietnam.ID {
+			t.Errorf("tree = %+v, want Drama > War > Vietnam", tree)
+		}
+
+		tests := []struct {
+			path string
+			want []string
+		}{
+			{categoryPath(drama.ID, "/movies"), []string{"Ordinary People"}},
+			{categoryPath(drama.ID, "/movies?recursive=true"), []string{"Ordinary People", "Platoon"}},
+			{categoryPath(war.ID, "/movies"), []string{}},
+			{categoryPath(war.ID, "/movies?recursive=true"), []string{"Platoon"}},
+			{"/movies?category=Drama", []string{"Ordinary People"}},
+			{"/movies?category=Drama&recursive=true", []string{"Ordinary People", "Platoon"}},
+		}
+		for _, tt := range tests {
+			var movies []Movie
+			ts.expect(ts.do("GET", tt.path, "", nil), http.StatusOK, &movies)
+			if got := titles(movies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: movies = %q, want %q", tt.path, got, tt.want)
+			}
+		}
+		ts.expect(ts.do("GET", categoryPath(drama.ID, "/movies?recursive=maybe"), "", nil), http.StatusBadRequest, nil)
+
+		// A category cannot move under itself or a descendant.
+		for _, parent := range []int{drama.ID, war.ID, vietnam.ID} {
+			ts.expect(ts.do("POST", categoryPath(drama.ID, "/move"), admin, map[string]int{"parent_id": parent}), http.StatusConflict, nil)
+		}
+		ts.expect(ts.do("POST", categoryPath(war.ID, "/move"), admin, map[string]int{"parent_id": comedy.ID}), http.StatusOK, nil)
+		ts.expect(ts.do("GET", "/categories", "", nil), http.StatusOK, &tree)
+		if len(tree) != 2 {
+			t.Fatalf("tree = %+v, want Comedy and Drama", tree)
+		}
+		for _, root := range tree {
+			if root.ID == comedy.ID && (len(root.Children) != 1 || root.Children[0].ID != war.ID) {
+				t.Errorf("Comedy's children = %+v, want War", root.Children)
+			}
+		}
+		ts.expect(ts.do("POST", categoryPath(war.ID, "/move"), admin, map[string]interface{}{"parent_id": nil}), http.StatusOK, nil)
+		if p := ts.category(war.ID).ParentID; p != nil {
+			t.Errorf("War's parent = %d, want none", *p)
+		}
+	})
+}
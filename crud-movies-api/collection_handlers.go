@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+func (s *server) getCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := s.store.ListCollections(r.Context())
+	if err != nil {
+		log.Printf("Error fetching collections: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, collections)
+}
+
+func (s *server) getCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := s.store.GetCollection(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching collection %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, collection)
+}
+
+// createCollection stores a collection of the movies whose ids the body
+// lists, in that order.
+func (s *server) createCollection(w http.ResponseWriter, r *http.Request) {
+	var collection Collection
+	if err := json.NewDecoder(r.Body).Decode(&collection); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	movieIDs, err := validateCollection(&collection)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.CreateCollection(r.Context(), &collection, movieIDs)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating collection: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, collection)
+}
+
+// updateCollection replaces a collection, including the order of its
+// movies.
+func (s *server) updateCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	var collection Collection
+	if err := json.NewDecoder(r.Body).Decode(&collection); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	movieIDs, err := validateCollection(&collection)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.UpdateCollection(r.Context(), id, &collection, movieIDs)
+	if err == ErrNotFound {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	// Otherwise one of the movies is missing.
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating collection: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, collection)
+}
+
+func (s *server) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.DeleteCollection(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting collection: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Collection deleted successfully"})
+}
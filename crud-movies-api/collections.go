@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Collection is a named, ordered list of movies, such as a series.
+// Clients give Movies by id only.
+type Collection struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Movies      []MovieRef `json:"movies"`
+}
+
+// CollectionRef places a movie in a collection, counting Position from 1.
+type CollectionRef struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+// validateCollection checks the fields a client sets on a collection and
+// returns the ids of its movies, in order.
+func validateCollection(c *Collection) ([]int, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	c.Description = strings.TrimSpace(c.Description)
+
+	seen := make(map[int]bool)
+	ids := []int{}
+	for _, m := range c.Movies {
+		id, err := strconv.Atoi(m.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid movie id %q", m.ID)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("movie %d appears twice", id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
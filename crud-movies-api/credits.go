@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// creditRoles are the roles a person can be credited with on a movie.
+var creditRoles = []string{"director", "writer", "producer", "composer", "cinematographer"}
+
+func knownCreditRole(role string) bool {
+	for _, r := range creditRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeCredits reconciles movie.Director with movie.Credits so that
+// clients may send either. Credits alone determine Director. A Director
+// that is not among the director credits replaces the one sharing its ID,
+// as when a client edits the director of a movie it fetched, and is
+// otherwise added; either way it becomes the first director credited.
+// Credited people are identified by name, as directors always have been,
+// so PersonIDs are cleared. The cast is normalized by normalizeCast.
+func normalizeCredits(movie *Movie) error {
+	for i := range movie.Credits {
+		c := &movie.Credits[i]
+		c.Role = strings.ToLower(strings.TrimSpace(c.Role))
+		if !knownCreditRole(c.Role) {
+			return fmt.Errorf("unknown credit role %q, expected one of %s", c.Role, strings.Join(creditRoles, ", "))
+		}
+		if c.Firstname == "" || c.Lastname == "" {
+			return fmt.Errorf("credited people need a first name and a last name")
+		}
+	}
+
+	first, match := -1, -1
+	for i, c := range movie.Credits {
+		if c.Role != "director" {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if match < 0 && c.Firstname == movie.Director.Firstname && c.Lastname == movie.Director.Lastname {
+			match = i
+		}
+	}
+	for i, c := range movie.Credits {
+		if match < 0 && movie.Director.ID != 0 && c.Role == "director" && c.PersonID == movie.Director.ID {
+			match = i
+		}
+	}
+
+	director := Credit{Firstname: movie.Director.Firstname, Lastname: movie.Director.Lastname, Role: "director"}
+	switch {
+	case director.Firstname == "" && director.Lastname == "":
+		if first >= 0 {
+			movie.Director = Director{Firstname: movie.Credits[first].Firstname, Lastname: movie.Credits[first].Lastname}
+		}
+	case match >= 0:
+		// Move the match ahead of the other directors.
+		copy(movie.Credits[first+1:match+1], movie.Credits[first:match])
+		movie.Credits[first] = director
+	default:
+		movie.Credits = append([]Credit{director}, movie.Credits...)
+	}
+
+	// Drop repeated credits, keeping the first.
+	seen := make(map[Credit]bool)
+	credits := movie.Credits[:0]
+	for _, c := range movie.Credits {
+		c.PersonID = 0
+		if !seen[c] {
+			seen[c] = true
+			credits = append(credits, c)
+		}
+	}
+	movie.Credits = credits
+	return normalizeCast(movie)
+}
+
+// normalizeCast numbers the cast 1, 2, ... in billing order. Members
+// without a billing follow those with one, in the order given.
+func normalizeCast(movie *Movie) error {
+	for i := range movie.Cast {
+		c := &movie.Cast[i]
+		if c.Firstname == "" || c.Lastname == "" {
+			return fmt.Errorf("cast members need a first name and a last name")
+		}
+		if c.Billing < 0 {
+			return fmt.Errorf("billing must be positive")
+		}
+		c.Character = strings.TrimSpace(c.Character)
+		c.PersonID = 0
+	}
+	sort.SliceStable(movie.Cast, func(i, j int) bool {
+		a, b := movie.Cast[i].Billing, movie.Cast[j].Billing
+		return a != 0 && (b == 0 || a < b)
+	})
+	for i := range movie.Cast {
+		movie.Cast[i].Billing = i + 1
+	}
+	return nil
+}
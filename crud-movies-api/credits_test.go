@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func directorCredit(firstname, lastname string) Credit {
+	return Credit{Firstname: firstname, Lastname: lastname, Role: "director"}
+}
+
+func TestNormalizeCredits(t *testing.T) {
+	scott := directorCredit("Ridley", "Scott")
+	tony := directorCredit("Tony", "Scott")
+	writer := Credit{Firstname: "Dan", Lastname: "O'Bannon", Role: "writer"}
+
+	tests := []struct {
+		name         string
+		director     Director
+		credits      []Credit
+		wantDirector Director
+		wantCredits  []Credit
+	}{
+		{
+			name:         "director only",
+			director:     Director{Firstname: "Ridley", Lastname: "Scott"},
+			wantDirector: Director{Firstname: "Ridley", Lastname: "Scott"},
+			wantCredits:  []Credit{scott},
+		},
+		{
+			name:         "credits only",
+			credits:      []Credit{writer, tony, scott},
+			wantDirector: Director{Firstname: "Tony", Lastname: "Scott"},
+			wantCredits:  []Credit{writer, tony, scott},
+		},
+		{
+			name:         "director moves ahead of the other directors",
+			director:     Director{Firstname: "Ridley", Lastname: "Scott"},
+			credits:      []Credit{writer, tony, scott},
+			wantDirector: Director{Firstname: "Ridley", Lastname: "Scott"},
+			wantCredits:  []Credit{writer, scott, tony},
+		},
+		{
+			name:         "renamed director replaces the credit with its id",
+			director:     Director{ID: 7, Firstname: "Ridley", Lastname: "Scott"},
+			credits:      []Credit{{PersonID: 7, Firstname: "R.", Lastname: "Scott", Role: "director"}, writer},
+			wantDirector: Director{ID: 7, Firstname: "Ridley", Lastname: "Scott"},
+			wantCredits:  []Credit{scott, writer},
+		},
+		{
+			name:         "new director is added first",
+			director:     Director{Firstname: "Ridley", Lastname: "Scott"},
+			credits:      []Credit{writer},
+			wantDirector: Director{Firstname: "Ridley", Lastname: "Scott"},
+			wantCredits:  []Credit{scott, writer},
+		},
+		{
+			name:         "repeated credits are dropped",
+			director:     Director{Firstname: "Ridley", Lastname: "Scott"},
+			credits:      []Credit{scott, writer, scott, {PersonID: 3, Firstname: "Dan", Lastname: "O'Bannon", Role: " Writer "}},
+			wantDirector: Director{Firstname: "Ridley", Lastname: "Scott"},
+			wantCredits:  []Credit{scott, writer},
+		},
+		{
+			name:         "one person in two roles",
+			credits:      []Credit{scott, {Firstname: "Ridley", Lastname: "Scott", Role: "producer"}},
+			wantDirector: Director{Firstname: "Ridley", Lastname: "Scott"},
+			wantCredits:  []Credit{scott, {Firstname: "Ridley", Lastname: "Scott", Role: "producer"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := Movie{Director: tt.director, Credits: append([]Credit{}, tt.credits...)}
+			if err := normalizeCredits(&movie); err != nil {
+				t.Fatal(err)
+			}
+			if movie.Director != tt.wantDirector {
+				t.Errorf("director = %+v, want %+v", movie.Director, tt.wantDirector)
+			}
+			if !reflect.DeepEqual(movie.Credits, tt.wantCredits) {
+				t.Errorf("credits = %+v, want %+v", movie.Credits, tt.wantCredits)
+			}
+		})
+	}
+
+	for _, credits := range [][]Credit{
+		{{Firstname: "Ridley", Lastname: "Scott", Role: "gaffer"}},
+		{{Firstname: "Ridley", Role: "director"}},
+	} {
+		movie := Movie{Credits: credits}
+		if err := normalizeCredits(&movie); err == nil {
+			t.Errorf("accepted credits %+v", credits)
+		}
+	}
+}
+
+func TestNormalizeCast(t *testing.T) {
+	movie := Movie{Cast: []CastMember{
+		{PersonID: 4, Firstname: "Yaphet", Lastname: "Kotto", Character: " Parker "},
+		{Firstname: "Tom", Lastname: "Skerritt", Character: "Dallas", Billing: 2},
+		{Firstname: "Sigourney", Lastname: "Weaver", Character: "Ripley", Billing: 1},
+		{Firstname: "Ian", Lastname: "Holm", Character: "Ash"},
+	}}
+	if err := normalizeCast(&movie); err != nil {
+		t.Fatal(err)
+	}
+	want := []CastMember{
+		{Firstname: "Sigourney", Lastname: "Weaver", Character: "Ripley", Billing: 1},
+		{Firstname: "Tom", Lastname: "Skerritt", Character: "Dallas", Billing: 2},
+		{Firstname: "Yaphet", Lastname: "Kotto", Character: "Parker", Billing: 3},
+		{Firstname: "Ian", Lastname: "Holm", Character: "Ash", Billing: 4},
+	}
+	if !reflect.DeepEqual(movie.Cast, want) {
+		t.Errorf("cast = %+v, want %+v", movie.Cast, want)
+	}
+
+	for _, cast := range [][]CastMember{
+		{{Firstname: "Sigourney", Billing: 1}},
+		{{Firstname: "Sigourney", Lastname: "Weaver", Billing: -1}},
+	} {
+		movie := Movie{Cast: cast}
+		if err := normalizeCast(&movie); err == nil {
+			t.Errorf("accepted cast %+v", cast)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *server) getDirectors(w http.ResponseWriter, r *http.Request) {
+	directors, err := s.store.ListDirectors(r.Context())
+	if err != nil {
+		log.Printf("Error fetching directors: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if directors == nil {
+		directors = []Director{}
+	}
+	writeJSON(w, http.StatusOK, directors)
+}
+
+func (s *server) getDirector(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid director id", http.StatusBadRequest)
+		return
+	}
+
+	director, err := s.store.GetDirector(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Director not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching director %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, director)
+}
+
+func (s *server) createDirector(w http.ResponseWriter, r *http.Request) {
+	var director Director
+	if err := json.NewDecoder(r.Body).Decode(&director); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDirector(director); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := s.store.CreateDirector(r.Context(), &director)
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating director: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, director)
+}
+
+func (s *server) updateDirector(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid director id", http.StatusBadRequest)
+		return
+	}
+
+	var director Director
+	if err := json.NewDecoder(r.Body).Decode(&director); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateDirector(director); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.UpdateDirector(r.Context(), id, &director)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Director not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating director: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, director)
+}
+
+func (s *server) deleteDirector(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid director id", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.DeleteDirector(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Director not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting director: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Director deleted successfully"})
+}
+
+// mergeDirector folds director {id} into director {target}: the target
+// takes over every movie and {id} is deleted.
+func (s *server) mergeDirector(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid director id", http.StatusBadRequest)
+		return
+	}
+	target, err := strconv.Atoi(mux.Vars(r)["target"])
+	if err != nil {
+		http.Error(w, "Invalid target director id", http.StatusBadRequest)
+		return
+	}
+	if id == target {
+		http.Error(w, "Cannot merge a director into itself", http.StatusBadRequest)
+		return
+	}
+
+	director, err := s.store.MergeDirectors(r.Context(), id, target)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Director not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error merging director %d into %d: %v", id, target, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, director)
+}
+
+// getMoviesByDirector lists a director's filmography, with the same paging,
+// sorting and filters as GET /movies.
+func (s *server) getMoviesByDirector(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid director id", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseListOptions(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.DirectorID = id
+
+	if _, err := s.store.GetDirector(r.Context(), id); errors.Is(err, ErrNotFound) {
+		http.Error(w, "Director not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching director %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page, err := s.store.ListMovies(r.Context(), opts)
+	if err != nil {
+		log.Printf("Error fetching movies by director: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeMoviePage(w, page)
+}
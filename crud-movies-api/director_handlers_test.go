@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func directorPath(id int, rest string) string {
+	return "/directors/" + strconv.Itoa(id) + rest
+}
+
+// filmography returns the titles of a director's movies in the order listed.
+func (ts *testServer) filmography(path string) []string {
+	ts.t.Helper()
+	var movies []Movie
+	ts.expect(ts.do("GET", path, "", nil), http.StatusOK, &movies)
+	titles := []string{}
+	for _, m := range movies {
+		titles = append(titles, m.Title)
+	}
+	return titles
+}
+
+func TestDirectorCRUD(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		var scott Director
+		ts.expect(ts.do("POST", "/directors", admin, Director{Firstname: "Ridley", Lastname: "Scott"}), http.StatusCreated, &scott)
+		ts.expect(ts.do("POST", "/directors", admin, Director{Firstname: "Ridley", Lastname: "Scott"}), http.StatusConflict, nil)
+		ts.expect(ts.do("POST", "/directors", admin, Director{Firstname: "Ridley"}), http.StatusBadRequest, nil)
+
+		// Movies naming the director are linked to them.
+		alien := ts.createMovie(admin, testMovie("Alien", 1979))
+		if alien.Director.ID != scott.ID {
+			t.Errorf("Alien's director is %d, want %d", alien.Director.ID, scott.ID)
+		}
+
+		var got Director
+		ts.expect(ts.do("GET", directorPath(scott.ID, ""), "", nil), http.StatusOK, &got)
+		if got != scott {
+			t.Errorf("GET returned %+v, want %+v", got, scott)
+		}
+		var all []Director
+		ts.expect(ts.do("GET", "/directors", "", nil), http.StatusOK, &all)
+		if !reflect.DeepEqual(all, []Director{scott}) {
+			t.Errorf("directors = %+v", all)
+		}
+
+		var tony Director
+		ts.expect(ts.do("POST", "/directors", admin, Director{Firstname: "Tony", Lastname: "Scott"}), http.StatusCreated, &tony)
+		ts.expect(ts.do("PUT", directorPath(tony.ID, ""), admin, Director{Firstname: "Ridley", Lastname: "Scott"}), http.StatusConflict, nil)
+		ts.expect(ts.do("PUT", directorPath(999, ""), admin, Director{Firstname: "Tony", Lastname: "Scott"}), http.StatusNotFound, nil)
+
+		// Only directors no movie credits can be deleted.
+		ts.expect(ts.do("DELETE", directorPath(scott.ID, ""), admin, nil), http.StatusConflict, nil)
+		ts.expect(ts.do("DELETE", directorPath(tony.ID, ""), admin, nil), http.StatusOK, nil)
+		ts.expect(ts.do("GET", directorPath(tony.ID, ""), "", nil), http.StatusNotFound, nil)
+		ts.expect(ts.do("DELETE", directorPath(tony.ID, ""), admin, nil), http.StatusNotFound, nil)
+
+		editor := ts.login("editor", roleEditor)
+		ts.expect(ts.do("DELETE", directorPath(scott.ID, ""), editor, nil), http.StatusForbidden, nil)
+	})
+}
+
+func TestDirectorFilmographyAndMerge(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		alien := ts.createMovie(admin, testMovie("Alien", 1979))
+		scott := alien.Director.ID
+		ts.createMovie(admin, testMovie("Gladiator", 2000))
+		// Producing is not directing.
+		produced := testMovie("Thelma & Louise", 1991)
+		produced.Director = Director{Firstname: "Callie", Lastname: "Khouri"}
+		produced.Credits = []Credit{{Firstname: "Ridley", Lastname: "Scott", Role: "producer"}}
+		ts.createMovie(admin, produced)
+		typo := testMovie("Blade Runner", 1982)
+		typo.Director = Director{Firstname: "R.", Lastname: "Scott"}
+		duplicate := ts.createMovie(admin, typo).Director.ID
+
+		if got, want := ts.filmography(directorPath(scott, "/movies?sort=-year")), []string{"Gladiator", "Alien"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("filmography = %q, want %q", got, want)
+		}
+		if got, want := ts.filmography("/people/"+strconv.Itoa(scott)+"/movies?sort=year"), []string{"Alien", "Thelma & Louise", "Gladiator"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("every credit = %q, want %q", got, want)
+		}
+		ts.expect(ts.do("GET", directorPath(999, "/movies"), "", nil), http.StatusNotFound, nil)
+
+		merge := func(id, into int) string { return directorPath(id, "/merge-into/"+strconv.Itoa(into)) }
+		ts.expect(ts.do("POST", merge(scott, scott), admin, nil), http.StatusBadRequest, nil)
+		ts.expect(ts.do("POST", merge(duplicate, 999), admin, nil), http.StatusNotFound, nil)
+		var into Director
+		ts.expect(ts.do("POST", merge(duplicate, scott), admin, nil), http.StatusOK, &into)
+		if into.ID != scott || into.Firstname != "Ridley" {
+			t.Errorf("merge returned %+v", into)
+		}
+		ts.expect(ts.do("GET", directorPath(duplicate, ""), "", nil), http.StatusNotFound, nil)
+		if got, want := ts.filmography(directorPath(scott, "/movies?sort=year")), []string{"Alien", "Blade Runner", "Gladiator"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("filmography after the merge = %q, want %q", got, want)
+		}
+	})
+}
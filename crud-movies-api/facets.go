@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// facetTypes are the facets a search can request.
+var facetTypes = []string{"category", "director", "decade"}
+
+// maxFacetValues caps the category and director facets to their most
+// common values.
+const maxFacetValues = 20
+
+// FacetValue counts the matching movies sharing one value. Value is what
+// to filter on to drill down: a category id, a director id, or the first
+// year of a decade.
+type FacetValue struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// Facets maps each requested facet type to its values. Categories and
+// directors are ordered by count, decades chronologically.
+type Facets map[string][]FacetValue
+
+// parseFacets reads a comma-separated facets parameter; "true" or "all"
+// requests every facet.
+func parseFacets(v string) ([]string, error) {
+	if v == "true" || v == "all" {
+		return facetTypes, nil
+	}
+	var facets []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		known := false
+		for _, t := range facetTypes {
+			known = known || t == f
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown facet %q", f)
+		}
+		facets = append(facets, f)
+	}
+	return facets, nil
+}
+
+// decadeLabel names the decade starting at year, e.g. "1990s".
+func decadeLabel(decade int) string {
+	return strconv.Itoa(decade) + "s"
+}
+
+// computeFacets counts the requested facets over movies in process, for
+// stores that cannot aggregate themselves.
+func computeFacets(movies []Movie, kinds []string) Facets {
+	facets := make(Facets)
+	for _, kind := range kinds {
+		counts := make(map[string]*FacetValue)
+		add := func(value, label string) {
+			if fv, ok := counts[value]; ok {
+				fv.Count++
+			} else {
+				counts[value] = &FacetValue{Value: value, Label: label, Count: 1}
+			}
+		}
+		for _, m := range movies {
+			switch kind {
+			case "category":
+				for _, c := range m.Categories {
+					add(strconv.Itoa(c.ID), c.Name)
+				}
+			case "director":
+				for _, c := range m.Credits {
+					if c.Role == "director" {
+						add(strconv.Itoa(c.PersonID), c.Firstname+" "+c.Lastname)
+					}
+				}
+			case "decade":
+				if m.Year != 0 {
+					decade := m.Year / 10 * 10
+					add(strconv.Itoa(decade), decadeLabel(decade))
+				}
+			}
+		}
+
+		values := []FacetValue{}
+		for _, fv := range counts {
+			values = append(values, *fv)
+		}
+		if kind == "decade" {
+			sort.Slice(values, func(i, j int) bool { return values[i].Label < values[j].Label })
+		} else {
+			sort.Slice(values, func(i, j int) bool {
+				if values[i].Count != values[j].Count {
+					return values[i].Count > values[j].Count
+				}
+				return values[i].Label < values[j].Label
+			})
+			if len(values) > maxFacetValues {
+				values = values[:maxFacetValues]
+			}
+		}
+		facets[kind] = values
+	}
+	return facets
+}
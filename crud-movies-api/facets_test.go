@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseFacets(t *testing.T) {
+	tests := []struct {
+		v    string
+		want []string
+		ok   bool
+	}{
+		{"all", facetTypes, true},
+		{"true", facetTypes, true},
+		{"decade", []string{"decade"}, true},
+		{"director, category", []string{"director", "category"}, true},
+		{"genre", nil, false},
+		{"decade,", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseFacets(tt.v)
+		if tt.ok && (err != nil || !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("parseFacets(%q) = %q, %v; want %q", tt.v, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("parseFacets(%q) = %q, want an error", tt.v, got)
+		}
+	}
+}
+
+// facetLabels returns the label and count of each value, in order.
+func facetLabels(values []FacetValue) []string {
+	labels := []string{}
+	for _, v := range values {
+		labels = append(labels, v.Label+"="+strconv.Itoa(v.Count))
+	}
+	return labels
+}
+
+func TestSearchFacets(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		var scott int
+		for _, m := range []struct {
+			title      string
+			year       int
+			director   Director
+			categories []string
+		}{
+			{"Alien", 1979, Director{Firstname: "Ridley", Lastname: "Scott"}, []string{"Sci-Fi", "Horror"}},
+			{"Blade Runner", 1982, Director{Firstname: "Ridley", Lastname: "Scott"}, []string{"Sci-Fi"}},
+			{"Aliens", 1986, Director{Firstname: "James", Lastname: "Cameron"}, []string{"Sci-Fi", "Action"}},
+			{"Annie Hall", 1977, Director{Firstname: "Woody", Lastname: "Allen"}, []string{"Comedy"}},
+		} {
+			movie := testMovie(m.title, m.year)
+			movie.Director = m.director
+			for _, name := range m.categories {
+				movie.Categories = append(movie.Categories, Category{Name: name})
+			}
+			created := ts.createMovie(admin, movie)
+			if m.title == "Alien" {
+				scott = created.Director.ID
+			}
+		}
+
+		// Facets count every match, not only those on the page.
+		var resp searchResponse
+		ts.expect(ts.do("GET", "/movies/search?q=category:sci-fi&fuzzy=false&limit=1&facets=all", "", nil), http.StatusOK, &resp)
+		if resp.Total != 3 || len(resp.Results) != 1 {
+			t.Errorf("total = %d with %d results, want 3 with 1", resp.Total, len(resp.Results))
+		}
+		want := map[string][]string{
+			"category": {"Sci-Fi=3", "Action=1", "Horror=1"},
+			"director": {"Ridley Scott=2", "James Cameron=1"},
+			"decade":   {"1970s=1", "1980s=2"},
+		}
+		for kind, labels := range want {
+			if got := facetLabels(resp.Facets[kind]); !reflect.DeepEqual(got, labels) {
+				t.Errorf("%s facet = %q, want %q", kind, got, labels)
+			}
+		}
+		if director := resp.Facets["director"]; len(director) == 0 || director[0].Value != strconv.Itoa(scott) {
+			t.Errorf("director facet = %+v, want Ridley Scott's id %d first", director, scott)
+		}
+
+		// Only the facets asked for are counted.
+		resp = searchResponse{}
+		ts.expect(ts.do("GET", "/movies/search?q=category:sci-fi&fuzzy=false&facets=decade", "", nil), http.StatusOK, &resp)
+		if len(resp.Facets) != 1 || len(resp.Facets["decade"]) != 2 {
+			t.Errorf("facets = %+v, want only decades", resp.Facets)
+		}
+		resp = searchResponse{}
+		ts.expect(ts.do("GET", "/movies/search?q=category:sci-fi&fuzzy=false", "", nil), http.StatusOK, &resp)
+		if resp.Facets != nil {
+			t.Errorf("facets = %+v, want none", resp.Facets)
+		}
+		ts.expect(ts.do("GET", "/movies/search?q=alien&facets=genre", "", nil), http.StatusBadRequest, nil)
+	})
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxListLimit caps the page size a client may request.
+const maxListLimit = 500
+
+// ListOptions controls paging, ordering and filtering of movie listings.
+type ListOptions struct {
+	// Limit is the page size; zero returns every matching movie.
+	Limit  int
+	Offset int
+	Sort   string
+	Desc   bool
+	// After resumes a listing from a cursor returned by a previous page.
+	After *movieCursor
+
+	Category   string // category id or name
+	DirectorID int    // credited as a director
+	PersonID   int    // credited in any role or cast
+	HasCover   *bool
+
+	// Subcategories widens Category, and MoviesByCategory, to the
+	// category's descendants.
+	Subcategories bool
+
+	// Zero leaves a bound open; movies with an unknown value never pass
+	// a bound.
+	YearFrom, YearTo       int
+	RuntimeMin, RuntimeMax int
+
+	Language      string // ISO 639-1, lower case
+	Country       string // ISO 3166-1 alpha-2, upper case
+	ContentRating string
+
+	// Tags must all be on a movie; names match regardless of case.
+	Tags []string
+
+	// Facets lists the facets to count over every matching movie.
+	Facets []string
+}
+
+// MoviePage is one page of a movie listing.
+type MoviePage struct {
+	Movies     []Movie
+	Total      int
+	NextCursor string
+	Facets     Facets
+}
+
+// movieSortColumn is an ORDER BY expression. When set, param wraps the
+// cursor placeholder so it compares against expr with the right type.
+type movieSortColumn struct {
+	expr  string
+	param string
+}
+
+// movieSort describes a sort order; key returns a movie's values for the
+// columns, in order, as strings, int64s or float64s.
+type movieSort struct {
+	columns []movieSortColumn
+	key     func(m Movie) []interface{}
+}
+
+var movieSorts = map[string]movieSort{
+	"title": {
+		columns: []movieSortColumn{{expr: "m.title"}},
+		key:     func(m Movie) []interface{} { return []interface{}{m.Title} },
+	},
+	"director": {
+		columns: []movieSortColumn{{expr: "d.lastname"}, {expr: "d.firstname"}},
+		key:     func(m Movie) []interface{} { return []interface{}{m.Director.Lastname, m.Director.Firstname} },
+	},
+	"created_at": {
+		columns: []movieSortColumn{{expr: "m.created_at", param: "to_timestamp(%s::bigint / 1000000.0)"}},
+		key:     func(m Movie) []interface{} { return []interface{}{m.CreatedAt.UnixMicro()} },
+	},
+	"year": {
+		columns: []movieSortColumn{{expr: "COALESCE(m.year, 0)"}},
+		key:     func(m Movie) []interface{} { return []interface{}{int64(m.Year)} },
+	},
+	"runtime": {
+		columns: []movieSortColumn{{expr: "COALESCE(m.runtime, 0)"}},
+		key:     func(m Movie) []interface{} { return []interface{}{int64(m.Runtime)} },
+	},
+	// relevance is only available to searches, whose source exposes m.rank.
+	"relevance": {
+		columns: []movieSortColumn{{expr: "m.rank"}},
+		key:     func(m Movie) []interface{} { return []interface{}{m.Rank} },
+	},
+}
+
+// movieCursor marks the last movie of a page. It is handed to clients as
+// an opaque base64 string.
+type movieCursor struct {
+	Sort string        `json:"s"`
+	Desc bool          `json:"d"`
+	Key  []interface{} `json:"k"`
+	ID   int64         `json:"i"`
+}
+
+func newMovieCursor(opts ListOptions, m Movie) string {
+	id, _ := strconv.ParseInt(m.ID, 10, 64)
+	c := movieCursor{Sort: opts.Sort, Desc: opts.Desc, Key: movieSorts[opts.Sort].key(m), ID: id}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeMovieCursor(s string) (*movieCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	var c movieCursor
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	sort, ok := movieSorts[c.Sort]
+	if !ok || len(c.Key) != len(sort.columns) {
+		return nil, fmt.Errorf("cursor does not match a known sort")
+	}
+	// Restore each value to the type the sort key produces.
+	for i, want := range sort.key(Movie{}) {
+		var err error
+		switch want.(type) {
+		case string:
+			if _, ok := c.Key[i].(string); !ok {
+				err = fmt.Errorf("expected a string")
+			}
+		case int64:
+			n, _ := c.Key[i].(json.Number)
+			c.Key[i], err = n.Int64()
+		case float64:
+			n, _ := c.Key[i].(json.Number)
+			c.Key[i], err = n.Float64()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cursor value %d: %w", i, err)
+		}
+	}
+	return &c, nil
+}
+
+// compareSortKeys orders two movie keys produced by movieSort.key.
+func compareSortKeys(a, b []interface{}) int {
+	for i := range a {
+		switch av := a[i].(type) {
+		case string:
+			if bv := b[i].(string); av != bv {
+				return strings.Compare(av, bv)
+			}
+		case int64:
+			if bv := b[i].(int64); av != bv {
+				if av < bv {
+					return -1
+				}
+				return 1
+			}
+		case float64:
+			if bv := b[i].(float64); av != bv {
+				if av < bv {
+					return -1
+				}
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// parseListOptions reads limit, offset, cursor, sort and filter parameters
+// from the query string. Searches default to, and alone may use, relevance
+// ordering, which puts the best match first, and alone may request facets.
+func parseListOptions(r *http.Request, search bool) (ListOptions, error) {
+	q := r.URL.Query()
+	opts := ListOptions{Sort: "title", Category: q.Get("category")}
+	if v := q.Get("recursive"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("recursive must be true or false")
+		}
+		opts.Subcategories = b
+	}
+	if search {
+		opts.Sort, opts.Desc = "relevance", true
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			return opts, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		opts.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("offset must be a non-negative integer")
+		}
+		opts.Offset = n
+	}
+
+	if v := q.Get("sort"); v != "" {
+		opts.Desc = strings.HasPrefix(v, "-")
+		opts.Sort = strings.TrimPrefix(v, "-")
+		if _, ok := movieSorts[opts.Sort]; !ok || (opts.Sort == "relevance" && !search) {
+			return opts, fmt.Errorf("unknown sort %q", v)
+		}
+		if opts.Sort == "relevance" {
+			opts.Desc = !opts.Desc
+		}
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if opts.Offset != 0 {
+			return opts, fmt.Errorf("cursor and offset cannot be combined")
+		}
+		c, err := decodeMovieCursor(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid cursor")
+		}
+		if c.Sort != opts.Sort || c.Desc != opts.Desc {
+			return opts, fmt.Errorf("cursor was issued for a different sort")
+		}
+		opts.After = c
+	}
+
+	if v := q.Get("director_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("director_id must be an integer")
+		}
+		opts.DirectorID = n
+	}
+	if v := q.Get("person_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("person_id must be an integer")
+		}
+		opts.PersonID = n
+	}
+	for _, p := range []struct {
+		name string
+		dest *int
+	}{
+		{"year_from", &opts.YearFrom},
+		{"year_to", &opts.YearTo},
+		{"runtime_min", &opts.RuntimeMin},
+		{"runtime_max", &opts.RuntimeMax},
+	} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("%s must be a positive integer", p.name)
+			}
+			*p.dest = n
+		}
+	}
+	opts.Language = strings.ToLower(q.Get("language"))
+	opts.Country = strings.ToUpper(q.Get("country"))
+	opts.ContentRating = strings.ToUpper(q.Get("content_rating"))
+	for _, t := range q["tag"] {
+		if t = strings.Join(strings.Fields(t), " "); t != "" {
+			opts.Tags = append(opts.Tags, t)
+		}
+	}
+	if v := q.Get("has_cover"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("has_cover must be true or false")
+		}
+		opts.HasCover = &b
+	}
+	if v := q.Get("facets"); v != "" && search {
+		facets, err := parseFacets(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Facets = facets
+	}
+
+	return opts, nil
+}
+
+// setPageHeaders reports the total count and next cursor of a page in
+// X-Total-Count and X-Next-Cursor.
+func setPageHeaders(w http.ResponseWriter, page MoviePage) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+}
+
+// writeMoviePage writes the movies as a JSON array, with the paging
+// details in headers.
+func writeMoviePage(w http.ResponseWriter, page MoviePage) {
+	setPageHeaders(w, page)
+	movies := page.Movies
+	if movies == nil {
+		movies = []Movie{}
+	}
+	writeJSON(w, http.StatusOK, movies)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMovieCursorRoundTrip(t *testing.T) {
+	movie := Movie{
+		ID:        "42",
+		Title:     "Alien",
+		Year:      1979,
+		Runtime:   117,
+		Rank:      0.75,
+		Director:  Director{Firstname: "Ridley", Lastname: "Scott"},
+		CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC),
+	}
+	for sort := range movieSorts {
+		for _, desc := range []bool{false, true} {
+			opts := ListOptions{Sort: sort, Desc: desc}
+			c, err := decodeMovieCursor(newMovieCursor(opts, movie))
+			if err != nil {
+				t.Fatalf("%s: %v", sort, err)
+			}
+			if c.Sort != sort || c.Desc != desc || c.ID != 42 {
+				t.Errorf("%s: cursor = %+v", sort, c)
+			}
+			if want := movieSorts[sort].key(movie); !reflect.DeepEqual(c.Key, want) {
+				t.Errorf("%s: key = %#v, want %#v", sort, c.Key, want)
+			}
+		}
+	}
+
+	for _, bad := range []string{"!", "bm90IGpzb24", newMovieCursor(ListOptions{Sort: "title"}, movie)[:10]} {
+		if _, err := decodeMovieCursor(bad); err == nil {
+			t.Errorf("decoded the invalid cursor %q", bad)
+		}
+	}
+}
+
+func TestCompareSortKeys(t *testing.T) {
+	tests := []struct {
+		a, b []interface{}
+		want int
+	}{
+		{[]interface{}{"Alien"}, []interface{}{"Brazil"}, -1},
+		{[]interface{}{"Scott", "Tony"}, []interface{}{"Scott", "Ridley"}, 1},
+		{[]interface{}{"Scott", "Ridley"}, []interface{}{"Scott", "Ridley"}, 0},
+		{[]interface{}{int64(1979)}, []interface{}{int64(1982)}, -1},
+		{[]interface{}{int64(1982)}, []interface{}{int64(1979)}, 1},
+		{[]interface{}{0.5}, []interface{}{0.25}, 1},
+	}
+	for _, tt := range tests {
+		if got := compareSortKeys(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareSortKeys(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestListOptionsCursor(t *testing.T) {
+	cursor := newMovieCursor(ListOptions{Sort: "year", Desc: true}, Movie{ID: "1", Year: 1979})
+	tests := []struct {
+		query string
+		ok    bool
+	}{
+		{"sort=-year&cursor=" + cursor, true},
+		{"sort=year&cursor=" + cursor, false},
+		{"sort=-title&cursor=" + cursor, false},
+		{"cursor=" + cursor, false},
+		{"sort=-year&offset=2&cursor=" + cursor, false},
+		{"sort=-year&cursor=garbage", false},
+	}
+	for _, tt := range tests {
+		opts, err := parseListOptions(httptest.NewRequest("GET", "/movies?"+tt.query, nil), false)
+		if tt.ok && (err != nil || opts.After == nil) {
+			t.Errorf("%s: opts.After = %v, err = %v", tt.query, opts.After, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: want an error", tt.query)
+		}
+	}
+}
+
+func TestMoviePaging(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+		// Ties on the year are broken by id, so no movie is skipped or
+		// repeated across pages.
+		for i, year := range []int{1979, 1982, 1979, 1982, 1982, 1986, 1979} {
+			ts.createMovie(admin, testMovie("Movie "+strconv.Itoa(i), year))
+		}
+
+		var all []Movie
+		ts.expect(ts.do("GET", "/movies?sort=-year", "", nil), http.StatusOK, &all)
+		var want []string
+		for i, m := range all {
+			want = append(want, m.ID)
+			if i > 0 && m.Year > all[i-1].Year {
+				t.Errorf("movie %d (%d) follows a movie of %d", i, m.Year, all[i-1].Year)
+			}
+		}
+
+		var got []string
+		path := "/movies?sort=-year&limit=2"
+		for pages := 1; ; pages++ {
+			rec := ts.do("GET", path, "", nil)
+			var page []Movie
+			ts.expect(rec, http.StatusOK, &page)
+			if total := rec.Header().Get("X-Total-Count"); total != strconv.Itoa(len(all)) {
+				t.Errorf("page %d: X-Total-Count = %q, want %d", pages, total, len(all))
+			}
+			for _, m := range page {
+				got = append(got, m.ID)
+			}
+			cursor := rec.Header().Get("X-Next-Cursor")
+			if cursor == "" {
+				if len(page) != 1 {
+					t.Errorf("last page has %d movies, want 1", len(page))
+				}
+				break
+			}
+			if pages > len(all) {
+				t.Fatal("paging does not end")
+			}
+			path = "/movies?sort=-year&limit=2&cursor=" + cursor
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("paged ids = %v, want %v", got, want)
+		}
+
+		// A page that ends exactly at the last movie has no cursor either.
+		rec := ts.do("GET", "/movies?sort=-year&limit="+strconv.Itoa(len(all)), "", nil)
+		ts.expect(rec, http.StatusOK, nil)
+		if cursor := rec.Header().Get("X-Next-Cursor"); cursor != "" {
+			t.Errorf("a page of every movie has the cursor %q", cursor)
+		}
+	})
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/rs/cors"
@@ -20,692 +20,316 @@ import (
 const defaultCoverURL = "https://www.reelviews.net/resources/img/default_poster.jpg"
 
 type Movie struct {
-	ID string `json:"id"`
-	MID string `json:"mid"`
-	Title string `json:"title"`
-	Director Director `json:"director"`
-    Cover string `json:"cover"`
-    Categories []Category `json:"categories"`
+	ID               string       `json:"id"`
+	MID              string       `json:"mid"`
+	Title            string       `json:"title"`
+	Director         Director     `json:"director"` // the first director in Credits
+	Credits          []Credit     `json:"credits"`
+	Cast             []CastMember `json:"cast"`
+	Cover            string       `json:"cover"`
+	Categories       []Category   `json:"categories"`
+	Tags             []string     `json:"tags"`
+	Year             int          `json:"year,omitempty"`
+	ReleaseDate      string       `json:"release_date,omitempty"` // 2006-01-02
+	Runtime          int          `json:"runtime,omitempty"`      // minutes
+	Synopsis         string       `json:"synopsis,omitempty"`
+	OriginalLanguage string       `json:"original_language,omitempty"` // ISO 639-1
+	Countries        []string     `json:"countries,omitempty"`         // ISO 3166-1 alpha-2
+	ContentRating    string       `json:"content_rating,omitempty"`
+	CreatedAt        time.Time    `json:"created_at"`
+	// Relations and Collections are only set on a single movie.
+	Relations   []Relation      `json:"relations,omitempty"`
+	Collections []CollectionRef `json:"collections,omitempty"`
+	// Rank and Snippet are only set on search results.
+	Rank    float64 `json:"rank,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
 }
 
 type Director struct {
-	ID int `json:"id"`
+	ID        int    `json:"id"`
 	Firstname string `json:"firstname"`
-	Lastname string `json:"lastname"`
+	Lastname  string `json:"lastname"`
 }
 
-type Category struct {
-    ID   int    `json:"id"`
-    Name string `json:"name"`
+// Credit is a person's role on a movie, one of creditRoles.
+type Credit struct {
+	PersonID  int    `json:"person_id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Role      string `json:"role"`
 }
 
-var db *sql.DB
+// CastMember is a person playing a character. Billing orders the cast
+// from 1.
+type CastMember struct {
+	PersonID  int    `json:"person_id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Character string `json:"character"`
+	Billing   int    `json:"billing"`
+}
 
-func init() {
-	err := godotenv.Load("../.env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
+type Category struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	ParentID    *int   `json:"parent_id"` // nil for a root
+	Description string `json:"description"`
+	Color       string `json:"color,omitempty"` // #rrggbb
+	Icon        string `json:"icon,omitempty"`
+	SortOrder   int    `json:"sort_order"` // siblings are listed by SortOrder, then Name
+	// Rules make a smart category, which movies are not assigned to and
+	// which has no parent or children.
+	Rules *CategoryRules `json:"rules,omitempty"`
+	// MovieCount, the movies directly in the category, is only set when
+	// categories are listed, and Children only in a tree.
+	MovieCount *int       `json:"movie_count,omitempty"`
+	Children   []Category `json:"children,omitempty"`
 }
 
+// Tag is a free-form label on movies. Names are unique regardless of case.
+type Tag struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	MovieCount int    `json:"movie_count"`
+}
+
+// generateMID derives a movie's public identifier from what tells it apart
+// from other movies. Stores add a suffix to keep MIDs unique, see
+// midCandidate; once assigned, a MID never changes.
 func generateMID(movie Movie) string {
-    info := movie.Title + movie.Director.Firstname + movie.Director.Lastname
+	info := movie.Title + movie.Director.Firstname + movie.Director.Lastname
+
+	// Same-titled remakes differ in these.
+	info += strconv.Itoa(movie.Year) + movie.ReleaseDate + strconv.Itoa(movie.Runtime) +
+		movie.OriginalLanguage + strings.Join(movie.Countries, ",") + movie.ContentRating
 
-    for _, category := range movie.Categories {
-        info += category.Name
-    }
+	hash := sha256.Sum256([]byte(info))
 
-    hash := sha256.Sum256([]byte(info))
+	mid := hex.EncodeToString(hash[:10])
 
-    mid := hex.EncodeToString(hash[:10])
-    
-    return mid[:4] + "-" + mid[4:8] + "-" + mid[8:10]
+	return mid[:4] + "-" + mid[4:8] + "-" + mid[8:10]
 }
 
-func validateMovie(movie Movie) error {
-    if movie.Title == "" {
-        return fmt.Errorf("title is required")
-    }
-    if movie.Director.Firstname == "" || movie.Director.Lastname == "" {
-        return fmt.Errorf("director's first name and last name are required")
-    }
-    if movie.Cover == "" {
-        movie.Cover = defaultCoverURL
-    }
-    return nil
+// midCandidate returns the n-th MID to try, from 1, for a movie whose
+// generated MID is base: base itself, then base-2, base-3 and so on.
+func midCandidate(base string, n int) string {
+	if n == 1 {
+		return base
+	}
+	return base + "-" + strconv.Itoa(n)
 }
 
-func healthCheck(w http.ResponseWriter, r *http.Request) {
-    err := db.Ping()
-    if err != nil {
-        http.Error(w, "Database connection failed", http.StatusInternalServerError)
-        return
-    }
-    json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+// postgresConnStr builds the connection string from the DB_* variables.
+func postgresConnStr() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"))
 }
-func initDB() {
-	var err error
-	
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_PORT"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"))
-
-	log.Println("Connecting to database...")
-	db, err = sql.Open("postgres", connStr)
-	if err != nil {
-		log.Fatal(err)
-	} 
 
-	log.Println("Pinging database...")
-	if err = db.Ping(); err != nil {
-		log.Fatal(err)
+// openStore returns the storage backend selected by STORE_BACKEND
+// ("postgres", the default, or "memory").
+func openStore() (Store, error) {
+	switch backend := os.Getenv("STORE_BACKEND"); backend {
+	case "", "postgres":
+		return newPostgresStore(postgresConnStr())
+	case "memory":
+		log.Println("Using in-memory store")
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q", backend)
 	}
-
-	log.Println("Creating tables if not exist...")
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS directors (
-			id SERIAL PRIMARY KEY,
-			firstname TEXT,
-			lastname TEXT
-			)`)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS movies (
-            id SERIAL PRIMARY KEY,
-            mid TEXT,
-            title TEXT,
-            director_id INTEGER REFERENCES directors(id),
-            cover TEXT
-            )`)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-        _, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS categories (
-            id SERIAL PRIMARY KEY,
-            name TEXT UNIQUE
-            )`)
-        if err != nil {
-            log.Fatal(err)
-        }
-
-        _, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS movie_categories (
-            movie_id INTEGER REFERENCES movies(id),
-            category_id INTEGER REFERENCES categories(id),
-            PRIMARY KEY (movie_id, category_id)
-            )`)
-        if err != nil {
-            log.Fatal(err)
-        }
-	    log.Println("Database initialization complete")
 }
 
-func getMovies(w http.ResponseWriter, r *http.Request) {
-    params := mux.Vars(r)
-    if id, ok := params["id"]; ok {
-        //Get single movie
-        var movie Movie
-        err := db.QueryRow(`
-            SELECT m.id, m.mid, m.title, m.cover, d.id, d.firstname, d.lastname 
-            FROM movies m 
-            JOIN directors d ON m.director_id = d.id 
-            WHERE m.id = $1`, id).Scan(
-            &movie.ID, &movie.MID, &movie.Title, &movie.Cover, &movie.Director.ID, &movie.Director.Firstname, &movie.Director.Lastname)
-        if err != nil {
-            if err == sql.ErrNoRows {
-                http.Error(w, "Movie not found", http.StatusNotFound)
-            } else {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-            }
-            return
-        }
-
-        rows, err := db.Query(`
-            SELECT c.id, c.name 
-            FROM categories c 
-            JOIN movie_categories mc ON c.id = mc.category_id 
-            WHERE mc.movie_id = $1`, id)
-        if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        defer rows.Close()
-        
-        for rows.Next() {
-            var category Category
-            if err := rows.Scan(&category.ID, &category.Name); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
-            movie.Categories = append(movie.Categories, category)
-        }
-
-        json.NewEncoder(w).Encode(movie)
-    } else {
-        //Get all movies
-        rows, err := db.Query(`
-        SELECT m.id, m.mid, m.title, m.cover, d.id, d.firstname, d.lastname
-        FROM movies m
-        JOIN directors d ON m.director_id = d.id
-        Order BY m.title ASC`)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var movies []Movie
-    for rows.Next() {
-        var m Movie
-        err := rows.Scan(&m.ID, &m.MID, &m.Title, &m.Cover, &m.Director.ID, &m.Director.Firstname, &m.Director.Lastname)
-        if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        
-        // Fetch categories for each movie
-        catRows, err := db.Query(`
-            SELECT c.id, c.name 
-            FROM categories c 
-            JOIN movie_categories mc ON c.id = mc.category_id 
-            WHERE mc.movie_id = $1`, m.ID)
-        if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        defer catRows.Close()
-        
-        for catRows.Next() {
-            var category Category
-            if err := catRows.Scan(&category.ID, &category.Name); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
-            m.Categories = append(m.Categories, category)
-        }
-        
-        movies = append(movies, m)
-    }
-    json.NewEncoder(w).Encode(movies)
-    }
-
+// floatEnv reads a number from the environment, returning def when unset.
+func floatEnv(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, nil
 }
 
-func searchMovies(w http.ResponseWriter, r *http.Request) {
-    log.Println("searchMovies function called")
-
-    if mux.Vars(r)["id"] != "" {
-        log.Println("Invalid search request: id parameter detected")
-        http.Error(w, "Invalid search request", http.StatusBadRequest)
-        return
-    }
-
-    query := r.URL.Query().Get("q")
-    if query == "" {
-        log.Println("Empty search query")
-        http.Error(w, "Search query is required", http.StatusBadRequest)
-        return
-    }
-
-    log.Printf("Searching for movies with query: %s", query)
-    likeQuery := "%" + query + "%"
-
-    if err := db.Ping(); err != nil {
-        log.Printf("Database connection error: %v", err)
-        http.Error(w, "Database connection error", http.StatusInternalServerError)
-        return
-    }
-    log.Println("Database connection successful")
-
-    rows, err := db.Query(`
-        SELECT DISTINCT m.id, m.mid, m.title, m.cover, d.id, d.firstname, d.lastname
-        FROM movies m
-        JOIN directors d ON m.director_id = d.id
-        LEFT JOIN movie_categories mc ON m.id = mc.movie_id
-        LEFT JOIN categories c ON mc.category_id = c.id
-        WHERE m.title ILIKE $1
-        OR d.firstname ILIKE $1
-        OR d.lastname ILIKE $1
-        OR c.name ILIKE $1
-    `, likeQuery)
-
-    if err != nil {
-        log.Printf("Error executing search query: %v", err)
-        http.Error(w, fmt.Sprintf("Internal server error: %v", err), http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-    log.Println("Query executed successfully")
-
-    var movies []Movie
-    for rows.Next() {
-        var m Movie
-        err := rows.Scan(&m.ID, &m.MID, &m.Title, &m.Cover, &m.Director.ID, &m.Director.Firstname, &m.Director.Lastname)
-        if err != nil {
-            log.Printf("Error scanning row: %v", err)
-            http.Error(w, fmt.Sprintf("Error scanning row: %v", err), http.StatusInternalServerError)
-            return
-        }
-        log.Printf("Scanned movie: %+v", m)
-        movies = append(movies, m)
-    }
-
-    if err = rows.Err(); err != nil {
-        log.Printf("Error after scanning rows: %v", err)
-        http.Error(w, fmt.Sprintf("Error after scanning rows: %v", err), http.StatusInternalServerError)
-        return
-    }
-
-    log.Printf("Found %d movies matching query: %s", len(movies), query)
-
-    w.Header().Set("Content-Type", "application/json")
-    if err := json.NewEncoder(w).Encode(movies); err != nil {
-        log.Printf("Error encoding response: %v", err)
-        http.Error(w, "Error encoding response", http.StatusInternalServerError)
-        return
-    }
-
-    log.Println("Response sent successfully")
+// boolEnv reads a boolean from the environment, returning def when unset.
+func boolEnv(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
 }
 
-func updateMovie(w http.ResponseWriter, r *http.Request) {
-    log.Println("updateMovie function called")
-    params := mux.Vars(r)
-    id := params["id"]
-    log.Printf("Updating movie with ID: %s", id)
-
-    var movie Movie
-    err := json.NewDecoder(r.Body).Decode(&movie)
-    if err != nil {
-        log.Printf("Error decoding request body: %v", err)
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-    log.Printf("Received movie data: %+v", movie)
-
-    if err := validateMovie(movie); err != nil {
-        log.Printf("Movie validation failed: %v", err)
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-
-    tx, err := db.Begin()
-    if err != nil {
-        log.Printf("Error beginning transaction: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    // Update movie
-    _, err = tx.Exec("UPDATE movies SET mid = $1, title = $2, cover = $3 WHERE id = $4",
-        movie.MID, movie.Title, movie.Cover, id)
-    if err != nil {
-        tx.Rollback()
-        log.Printf("Error updating movie: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    // Update director
-    _, err = tx.Exec("UPDATE directors SET firstname = $1, lastname = $2 WHERE id = $3",
-        movie.Director.Firstname, movie.Director.Lastname, movie.Director.ID)
-    if err != nil {
-        tx.Rollback()
-        log.Printf("Error updating director: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    // Delete existing category associations
-    _, err = tx.Exec("DELETE FROM movie_categories WHERE movie_id = $1", id)
-    if err != nil {
-        tx.Rollback()
-        log.Printf("Error deleting existing categories: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    // Insert new category associations
-    for _, category := range movie.Categories {
-        var categoryID int
-        err = tx.QueryRow("SELECT id FROM categories WHERE name = $1", category.Name).Scan(&categoryID)
-        if err == sql.ErrNoRows {
-            err = tx.QueryRow("INSERT INTO categories (name) VALUES ($1) RETURNING id", category.Name).Scan(&categoryID)
-        }
-        if err != nil {
-            tx.Rollback()
-            log.Printf("Error getting or creating category: %v", err)
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        _, err = tx.Exec("INSERT INTO movie_categories (movie_id, category_id) VALUES ($1, $2)", id, categoryID)
-        if err != nil {
-            tx.Rollback()
-            log.Printf("Error inserting movie category: %v", err)
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-    }
-
-    if err = tx.Commit(); err != nil {
-        log.Printf("Error committing transaction: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    if err = cleanupEmptyCategories(); err != nil {
-        log.Printf("Error cleaning up empty categories: %v", err)
-    }
-
-    log.Println("Movie updated successfully")
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(movie)
+// durationEnv reads a duration such as "12h" from the environment,
+// returning def when unset.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive", name)
+	}
+	return d, nil
 }
 
-//Category management functions
-func getCategories(w http.ResponseWriter, r *http.Request) {
-    rows, err := db.Query(`
-        SELECT DISTINCT c.id, c.name 
-        FROM categories c
-        INNER JOIN movie_categories mc ON c.id = mc.category_id
-        ORDER BY c.name
-    `)
-    if err != nil {
-        log.Printf("Error fetching categories: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var categories []Category
-    for rows.Next() {
-        var c Category
-        if err := rows.Scan(&c.ID, &c.Name); err != nil {
-            log.Printf("Error scanning category: %v", err)
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        categories = append(categories, c)
-    }
-
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(categories)
+// runMigrate implements the "migrate up|down [steps]|status" command.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+
+	db, err := openPostgres(postgresConnStr())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		log.Printf("Applied %d migration(s)", n)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		log.Printf("Reverted %d migration(s)", n)
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.AppliedAt != nil {
+				state = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
 }
 
-func createCategory(w http.ResponseWriter, r *http.Request) {
-    var category Category
-    err := json.NewDecoder(r.Body).Decode(&category)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-
-    err = db.QueryRow("INSERT INTO categories (name) VALUES ($1) RETURNING id", category.Name).Scan(&category.ID)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(category)
+func validateMovie(movie *Movie) error {
+	if movie.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if err := validateDirector(movie.Director); err != nil {
+		return err
+	}
+	if err := validateMetadata(movie); err != nil {
+		return err
+	}
+	if err := normalizeTags(movie); err != nil {
+		return err
+	}
+	normalizeMovieCategories(movie)
+	if movie.Cover == "" {
+		movie.Cover = defaultCoverURL
+	}
+	return nil
 }
 
-func updateCategory(w http.ResponseWriter, r *http.Request) {
-    params := mux.Vars(r)
-    id := params["id"]
-
-    var category Category
-    err := json.NewDecoder(r.Body).Decode(&category)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-
-    _, err = db.Exec("UPDATE categories SET name = $1 WHERE id = $2", category.Name, id)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    category.ID, _ = strconv.Atoi(id)
-    json.NewEncoder(w).Encode(category)
+func validateDirector(director Director) error {
+	if director.Firstname == "" || director.Lastname == "" {
+		return fmt.Errorf("director's first name and last name are required")
+	}
+	return nil
 }
 
-func deleteCategory(w http.ResponseWriter, r *http.Request) {
-    params := mux.Vars(r)
-    id := params["id"]
+func main() {
+	if err := godotenv.Load("../.env"); err != nil {
+		log.Fatal("Error loading .env file")
+	}
 
-    _, err := db.Exec("DELETE FROM categories WHERE id = $1", id)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "Category deleted successfully"})
-}
+	store, err := openStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
 
-func getMoviesByCategory(w http.ResponseWriter, r *http.Request) {
-    categoryID := mux.Vars(r)["id"]
-
-    rows, err := db.Query(`
-        SELECT DISTINCT m.id, m.mid, m.title, m.cover, d.id, d.firstname, d.lastname
-        FROM movies m
-        JOIN directors d ON m.director_id = d.id
-        JOIN movie_categories mc ON m.id = mc.movie_id
-        WHERE mc.category_id = $1
-    `, categoryID)
-    if err != nil {
-        log.Printf("Error fetching movies by category: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var movies []Movie
-    for rows.Next() {
-        var m Movie
-        err := rows.Scan(&m.ID, &m.MID, &m.Title, &m.Cover, &m.Director.ID, &m.Director.Firstname, &m.Director.Lastname)
-        if err != nil {
-            log.Printf("Error scanning movie: %v", err)
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        movies = append(movies, m)
-    }
-
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(movies)
-}
+	// ADMIN_USERNAME names the account that can grant roles to the others.
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		admin, err := bootstrapAdmin(context.Background(), store, username, os.Getenv("ADMIN_PASSWORD"))
+		if err != nil {
+			log.Fatalf("ADMIN_USERNAME: %v", err)
+		}
+		log.Printf("%s is an admin", admin.Username)
+	}
 
-func cleanupEmptyCategories() error {
-    _, err := db.Exec(`
-        DELETE FROM categories
-        WHERE id NOT IN (
-            SELECT DISTINCT category_id
-            FROM movie_categories
-        )
-    `)
-    return err
-}
+	srv := newServer(store)
+	if srv.searchSimilarity, err = floatEnv("SEARCH_SIMILARITY", srv.searchSimilarity); err != nil {
+		log.Fatal(err)
+	}
+	if srv.suggestSimilarity, err = floatEnv("SEARCH_SUGGEST_SIMILARITY", srv.suggestSimilarity); err != nil {
+		log.Fatal(err)
+	}
+	if srv.autoCleanupCategories, err = boolEnv("CLEANUP_EMPTY_CATEGORIES", srv.autoCleanupCategories); err != nil {
+		log.Fatal(err)
+	}
+	if srv.sessionTTL, err = durationEnv("SESSION_TTL", srv.sessionTTL); err != nil {
+		log.Fatal(err)
+	}
+	oidcConf, err := oidcConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if oidcConf != nil {
+		if srv.oidc, err = newOIDCAuth(context.Background(), *oidcConf); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Accepting OIDC logins from %s", oidcConf.Issuer)
+	}
+	r := srv.routes()
 
-func createMovie(w http.ResponseWriter, r *http.Request) {
-    var movie Movie
-    err := json.NewDecoder(r.Body).Decode(&movie)
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-
-	if err := validateMovie(movie); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-
-    movie.MID = generateMID(movie)
-
-    tx, err := db.Begin()
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    var directorID int
-    err = tx.QueryRow("SELECT id FROM directors WHERE firstname = $1 AND lastname = $2",
-        movie.Director.Firstname, movie.Director.Lastname).Scan(&directorID)
-    if err == sql.ErrNoRows {
-        //Director doesn't exist, create new
-        err = tx.QueryRow("INSERT INTO directors (firstname, lastname) VALUES ($1, $2) RETURNING id",
-            movie.Director.Firstname, movie.Director.Lastname).Scan(&directorID)
-    }
-    if err != nil {
-        tx.Rollback()
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    err = tx.QueryRow("INSERT INTO movies (mid, title, director_id, cover) VALUES ($1, $2, $3, $4) RETURNING id",
-        movie.MID, movie.Title, directorID, movie.Cover).Scan(&movie.ID)
-    if err != nil {
-        tx.Rollback()
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    for _, category := range movie.Categories {
-        var categoryID int
-        err = tx.QueryRow("SELECT id FROM categories WHERE name = $1", category.Name).Scan(&categoryID)
-        if err == sql.ErrNoRows {
-            err = tx.QueryRow("INSERT INTO categories (name) VALUES ($1) RETURNING id", category.Name).Scan(&categoryID)
-        }
-        if err != nil {
-            tx.Rollback()
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        _, err = tx.Exec("INSERT INTO movie_categories (movie_id, category_id) VALUES ($1, $2)", movie.ID, categoryID)
-        if err != nil {
-            tx.Rollback()
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-    }
-
-    if err = tx.Commit(); err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(movie)
-}
+	c := cors.New(cors.Options{
+		AllowedOrigins:   []string{"http://localhost:8080"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{"X-Total-Count", "X-Next-Cursor"},
+		AllowCredentials: true,
+	})
 
-func deleteMovie(w http.ResponseWriter, r *http.Request) {
-    params := mux.Vars(r)
-    id := params["id"]
-
-    tx, err := db.Begin()
-    if err != nil {
-        log.Printf("Error beginning transaction: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    //Delete associated categories first
-    _, err = tx.Exec("DELETE FROM movie_categories WHERE movie_id = $1", id)
-    if err != nil {
-        tx.Rollback()
-        log.Printf("Error deleting movie categories: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    //Delete the movie
-    result, err := tx.Exec("DELETE FROM movies WHERE id = $1", id)
-    if err != nil {
-        tx.Rollback()
-        log.Printf("Error deleting movie: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    rowsAffected, err := result.RowsAffected()
-    if err != nil {
-        tx.Rollback()
-        log.Printf("Error getting rows affected: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    if rowsAffected == 0 {
-        tx.Rollback()
-        http.Error(w, "Movie not found", http.StatusNotFound)
-        return
-    }
-
-    //Delete the associated director if no other movies reference it
-    _, err = tx.Exec("DELETE FROM directors WHERE id NOT IN (SELECT DISTINCT director_id FROM movies)")
-    if err != nil {
-        tx.Rollback()
-        log.Printf("Error deleting orphaned directors: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    if err = tx.Commit(); err != nil {
-        log.Printf("Error committing transaction: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    if err = cleanupEmptyCategories(); err != nil {
-        log.Printf("Error cleaning up empty categories: %v", err)
-    }
-
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "Movie deleted successfully"})
-}
+	handler := c.Handler(r)
 
-func main() {
-    initDB()
-    defer db.Close()
-
-    r := mux.NewRouter()
-
-    r.HandleFunc("/health", healthCheck).Methods("GET")
-    r.HandleFunc("/movies/search", searchMovies).Methods("GET")  // Moved up
-    r.HandleFunc("/movies", getMovies).Methods("GET")
-    r.HandleFunc("/movies", createMovie).Methods("POST")
-    r.HandleFunc("/movies/{id}", getMovies).Methods("GET")
-    r.HandleFunc("/movies/{id}", updateMovie).Methods("PUT")
-    r.HandleFunc("/movies/{id}", deleteMovie).Methods("DELETE")
-    r.HandleFunc("/categories", getCategories).Methods("GET")
-    r.HandleFunc("/categories", createCategory).Methods("POST")
-    r.HandleFunc("/categories/{id}", updateCategory).Methods("PUT")
-    r.HandleFunc("/categories/{id}", deleteCategory).Methods("DELETE")
-    r.HandleFunc("/categories/{id}/movies", getMoviesByCategory).Methods("GET")
-
-    c := cors.New(cors.Options{
-        AllowedOrigins: []string{"http://localhost:8080"},
-        AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-        AllowedHeaders: []string{"*"},
-        AllowCredentials: true,
-    })
-
-    handler := c.Handler(r)
-
-    port := os.Getenv("PORT")
-    if port == "" {
-        port = "8000"
-    }
-    fmt.Printf("Starting server at port %s\n", port)
-    log.Fatal(http.ListenAndServe(":"+port, handler))
-}
\ No newline at end of file
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8000"
+	}
+	fmt.Printf("Starting server at port %s\n", port)
+	log.Fatal(http.ListenAndServe(":"+port, handler))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+var midPattern = regexp.MustCompile(`^[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{2}$`)
+
+func TestGenerateMID(t *testing.T) {
+	base := Movie{
+		Title:    "Solaris",
+		Director: Director{Firstname: "Andrei", Lastname: "Tarkovsky"},
+		Year:     1972,
+	}
+	mid := generateMID(base)
+	if !midPattern.MatchString(mid) {
+		t.Fatalf("MID %q is not xxxx-xxxx-xx", mid)
+	}
+	if again := generateMID(base); again != mid {
+		t.Errorf("MID changed between calls: %q, %q", mid, again)
+	}
+
+	// Whatever tells two movies apart changes the MID.
+	remake := base
+	remake.Director = Director{Firstname: "Steven", Lastname: "Soderbergh"}
+	remake.Year = 2002
+	sameYear := base
+	sameYear.Runtime = 167
+	dubbed := base
+	dubbed.OriginalLanguage = "ru"
+	for name, m := range map[string]Movie{"remake": remake, "runtime": sameYear, "language": dubbed} {
+		if generateMID(m) == mid {
+			t.Errorf("%s: MID did not change", name)
+		}
+	}
+
+	// What doesn't identify a movie leaves it alone.
+	edited := base
+	edited.Synopsis = "A psychologist is sent to a space station."
+	edited.Cover = "https://example.com/solaris.jpg"
+	edited.Tags = []string{"space"}
+	if generateMID(edited) != mid {
+		t.Error("MID changed with the synopsis, cover or tags")
+	}
+}
+
+func TestMIDCandidate(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{1, "abcd-ef01-23"},
+		{2, "abcd-ef01-23-2"},
+		{10, "abcd-ef01-23-10"},
+	}
+	for _, tt := range tests {
+		if got := midCandidate("abcd-ef01-23", tt.n); got != tt.want {
+			t.Errorf("midCandidate(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestCreateMovieKeepsMIDsUnique(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	movie := testMovie("Alien", 1979)
+	base := generateMID(movie)
+	var mids []string
+	for i := 0; i < 3; i++ {
+		m := movie
+		m.MID = base
+		if err := store.CreateMovie(ctx, &m); err != nil {
+			t.Fatal(err)
+		}
+		mids = append(mids, m.MID)
+	}
+	want := []string{base, base + "-2", base + "-3"}
+	for i := range want {
+		if mids[i] != want[i] {
+			t.Errorf("MIDs = %q, want %q", mids, want)
+			break
+		}
+	}
+
+	got, err := store.GetMovieByMID(ctx, base+"-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MID != base+"-2" {
+		t.Errorf("GetMovieByMID returned MID %q", got.MID)
+	}
+}
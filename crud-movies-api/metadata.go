@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// contentRatings are the MPAA-style ratings a movie may carry; NR is "not
+// rated".
+var contentRatings = []string{"G", "PG", "PG-13", "R", "NC-17", "NR"}
+
+const maxSynopsisLength = 5000
+
+// releaseDateLayout is the format of Movie.ReleaseDate.
+const releaseDateLayout = "2006-01-02"
+
+// isCode reports whether s is n ASCII letters, as in ISO 639-1 language and
+// ISO 3166-1 alpha-2 country codes.
+func isCode(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateMetadata checks the descriptive fields of a movie and normalizes
+// them: codes are cased canonically, countries deduplicated and a missing
+// year taken from the release date.
+func validateMetadata(movie *Movie) error {
+	if movie.ReleaseDate != "" {
+		released, err := time.Parse(releaseDateLayout, movie.ReleaseDate)
+		if err != nil {
+			return fmt.Errorf("release_date must look like 2006-01-02")
+		}
+		if movie.Year == 0 {
+			movie.Year = released.Year()
+		} else if movie.Year != released.Year() {
+			return fmt.Errorf("year %d does not match release_date %s", movie.Year, movie.ReleaseDate)
+		}
+	}
+	if movie.Year < 0 {
+		return fmt.Errorf("year must be positive")
+	}
+	if movie.Runtime < 0 {
+		return fmt.Errorf("runtime must be a positive number of minutes")
+	}
+
+	movie.Synopsis = strings.TrimSpace(movie.Synopsis)
+	if len([]rune(movie.Synopsis)) > maxSynopsisLength {
+		return fmt.Errorf("synopsis must be at most %d characters", maxSynopsisLength)
+	}
+
+	movie.OriginalLanguage = strings.ToLower(strings.TrimSpace(movie.OriginalLanguage))
+	if movie.OriginalLanguage != "" && !isCode(movie.OriginalLanguage, 2) {
+		return fmt.Errorf("original_language must be a two-letter ISO 639-1 code")
+	}
+
+	seen := make(map[string]bool)
+	countries := []string{}
+	for _, c := range movie.Countries {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if !isCode(c, 2) {
+			return fmt.Errorf("countries must be two-letter ISO 3166-1 codes, got %q", c)
+		}
+		if !seen[c] {
+			seen[c] = true
+			countries = append(countries, c)
+		}
+	}
+	movie.Countries = countries
+
+	if movie.ContentRating != "" {
+		movie.ContentRating = strings.ToUpper(strings.TrimSpace(movie.ContentRating))
+		known := false
+		for _, r := range contentRatings {
+			known = known || r == movie.ContentRating
+		}
+		if !known {
+			return fmt.Errorf("content_rating must be one of %s", strings.Join(contentRatings, ", "))
+		}
+	}
+	return nil
+}
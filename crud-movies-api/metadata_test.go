@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		movie Movie
+		ok    bool
+	}{
+		{"nothing", Movie{}, true},
+		{"year from release date", Movie{ReleaseDate: "1979-05-25"}, true},
+		{"matching year", Movie{Year: 1979, ReleaseDate: "1979-05-25"}, true},
+		{"year mismatch", Movie{Year: 1980, ReleaseDate: "1979-05-25"}, false},
+		{"bad date", Movie{ReleaseDate: "25/05/1979"}, false},
+		{"negative year", Movie{Year: -1}, false},
+		{"negative runtime", Movie{Runtime: -1}, false},
+		{"language", Movie{OriginalLanguage: " EN "}, true},
+		{"long language", Movie{OriginalLanguage: "eng"}, false},
+		{"non-letter language", Movie{OriginalLanguage: "e1"}, false},
+		{"bad country", Movie{Countries: []string{"US", "USA"}}, false},
+		{"rating", Movie{ContentRating: "pg-13"}, true},
+		{"unknown rating", Movie{ContentRating: "X"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMetadata(&tt.movie)
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+
+	movie := Movie{
+		ReleaseDate:      "1979-05-25",
+		Synopsis:         "  In space no one can hear you scream. ",
+		OriginalLanguage: "EN",
+		Countries:        []string{"us", " GB ", "US", "gb"},
+		ContentRating:    "r",
+	}
+	if err := validateMetadata(&movie); err != nil {
+		t.Fatal(err)
+	}
+	want := Movie{
+		Year:             1979,
+		ReleaseDate:      "1979-05-25",
+		Synopsis:         "In space no one can hear you scream.",
+		OriginalLanguage: "en",
+		Countries:        []string{"US", "GB"},
+		ContentRating:    "R",
+	}
+	if !reflect.DeepEqual(movie, want) {
+		t.Errorf("normalized = %+v, want %+v", movie, want)
+	}
+}
+
+func TestMovieMetadata(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		movie := testMovie("Alien", 1980)
+		movie.ReleaseDate = "1979-05-25"
+		ts.expect(ts.do("POST", "/movies", admin, movie), http.StatusBadRequest, nil)
+		movie.Year = 0
+		movie.OriginalLanguage = "english"
+		ts.expect(ts.do("POST", "/movies", admin, movie), http.StatusBadRequest, nil)
+
+		movie.OriginalLanguage = "EN"
+		movie.Countries = []string{"us", "GB", "US"}
+		created := ts.createMovie(admin, movie)
+		var got Movie
+		ts.expect(ts.do("GET", "/movies/"+created.ID, "", nil), http.StatusOK, &got)
+		if got.Year != 1979 || got.OriginalLanguage != "en" || !reflect.DeepEqual(got.Countries, []string{"US", "GB"}) {
+			t.Errorf("stored metadata: year %d, language %q, countries %q", got.Year, got.OriginalLanguage, got.Countries)
+		}
+	})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one numbered schema change. Files are named
+// NNNN_description.up.sql and NNNN_description.down.sql.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrationStatus reports whether a migration has been applied.
+type migrationStatus struct {
+	migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		base := path.Base(file)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", base)
+		}
+
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+		prefix, name, ok := strings.Cut(stem, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_description", base)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", base, prefix)
+		}
+
+		body, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous: expected %04d, found %04d", i+1, m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// migrator applies the embedded migrations to a database and records them
+// in the schema_migrations table.
+type migrator struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+func newMigrator(db *sql.DB) (*migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, migrations: migrations}, nil
+}
+
+// latest is the schema version this binary was built for.
+func (m *migrator) latest() int {
+	return len(m.migrations)
+}
+
+func (m *migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+func (m *migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Version returns the highest applied migration, or 0 for an empty database.
+func (m *migrator) Version(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// pending returns the migrations after version, in order.
+func (m *migrator) pending(version int) ([]migration, error) {
+	if version > m.latest() {
+		return nil, fmt.Errorf("database schema version %d is newer than this binary (%d)", version, m.latest())
+	}
+	return m.migrations[version:], nil
+}
+
+// Up applies every pending migration in order, each in its own transaction.
+func (m *migrator) Up(ctx context.Context) (int, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := m.pending(version)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mig := range pending {
+		err := m.run(ctx, mig.Up, "INSERT INTO schema_migrations (version) VALUES ($1)", mig.Version)
+		if err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down reverts the most recent steps migrations.
+func (m *migrator) Down(ctx context.Context, steps int) (int, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if version > m.latest() {
+		return 0, fmt.Errorf("database schema version %d is newer than this binary (%d)", version, m.latest())
+	}
+
+	count := 0
+	for ; count < steps && version > 0; version-- {
+		mig := m.migrations[version-1]
+		if mig.Down == "" {
+			return count, fmt.Errorf("migration %04d_%s has no down script", mig.Version, mig.Name)
+		}
+		err := m.run(ctx, mig.Down, "DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+		if err != nil {
+			return count, fmt.Errorf("reverting migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// run executes script and the bookkeeping statement in one transaction.
+func (m *migrator) run(ctx context.Context, script, record string, version int) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Status lists every known migration with the time it was applied.
+func (m *migrator) Status(ctx context.Context) ([]migrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]migrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i].migration = mig
+		if at, ok := applied[mig.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// Check returns an error unless the database is at exactly the schema
+// version this binary expects.
+func (m *migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > m.latest():
+		return fmt.Errorf("database schema version %d is unknown to this binary (latest %d); refusing to start", version, m.latest())
+	case version < m.latest():
+		return fmt.Errorf("database schema version %d is behind %d; run \"migrate up\" first", version, m.latest())
+	}
+	return nil
+}
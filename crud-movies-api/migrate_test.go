@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.Version)
+		}
+		if m.Name == "" || m.Up == "" || m.Down == "" {
+			t.Errorf("migration %04d_%s lacks a name or an up or down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	m := &migrator{migrations: []migration{{Version: 1}, {Version: 2}, {Version: 3}}}
+	tests := []struct {
+		version int
+		want    []int
+	}{
+		{0, []int{1, 2, 3}},
+		{1, []int{2, 3}},
+		{3, nil},
+	}
+	for _, tt := range tests {
+		pending, err := m.pending(tt.version)
+		if err != nil {
+			t.Fatalf("pending(%d): %v", tt.version, err)
+		}
+		var got []int
+		for _, mig := range pending {
+			got = append(got, mig.Version)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pending(%d) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+	if _, err := m.pending(4); err == nil {
+		t.Error("pending(4) of 3 migrations: want an error")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	m, err := newMigrator(newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Check(ctx); err == nil {
+		t.Error("Check passed on an empty database")
+	}
+	if n, err := m.Up(ctx); err != nil || n != m.latest() {
+		t.Fatalf("Up applied %d migrations, err %v; want %d", n, err, m.latest())
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Error(err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %04d is not recorded", s.Version)
+		} else if i > 0 && s.AppliedAt.Before(*statuses[i-1].AppliedAt) {
+			t.Errorf("migration %04d was applied before %04d", s.Version, statuses[i-1].Version)
+		}
+	}
+
+	// Applied migrations are skipped.
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Errorf("second Up applied %d migrations, err %v; want none", n, err)
+	}
+	if n, err := m.Down(ctx, 2); err != nil || n != 2 {
+		t.Fatalf("Down reverted %d migrations, err %v; want 2", n, err)
+	}
+	if version, err := m.Version(ctx); err != nil || version != m.latest()-2 {
+		t.Errorf("version = %d, err %v; want %d", version, err, m.latest()-2)
+	}
+	if n, err := m.Up(ctx); err != nil || n != 2 {
+		t.Errorf("Up after Down applied %d migrations, err %v; want 2", n, err)
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS movie_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS movies;
+DROP TABLE IF EXISTS directors;
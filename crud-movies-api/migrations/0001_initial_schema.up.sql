@@ -0,0 +1,26 @@
+-- Baseline schema. IF NOT EXISTS lets databases created before migrations
+-- existed adopt this version without changes.
+CREATE TABLE IF NOT EXISTS directors (
+    id SERIAL PRIMARY KEY,
+    firstname TEXT,
+    lastname TEXT
+);
+
+CREATE TABLE IF NOT EXISTS movies (
+    id SERIAL PRIMARY KEY,
+    mid TEXT,
+    title TEXT,
+    director_id INTEGER REFERENCES directors(id),
+    cover TEXT
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name TEXT UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS movie_categories (
+    movie_id INTEGER REFERENCES movies(id),
+    category_id INTEGER REFERENCES categories(id),
+    PRIMARY KEY (movie_id, category_id)
+);
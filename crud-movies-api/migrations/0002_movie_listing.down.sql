@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS movie_categories_category_id_idx;
+DROP INDEX IF EXISTS movies_director_id_idx;
+DROP INDEX IF EXISTS movies_created_at_idx;
+DROP INDEX IF EXISTS movies_title_idx;
+
+ALTER TABLE movies DROP COLUMN year;
+ALTER TABLE movies DROP COLUMN created_at;
@@ -0,0 +1,8 @@
+ALTER TABLE movies ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE movies ADD COLUMN year INTEGER;
+
+-- Support the sort orders and filters offered by GET /movies.
+CREATE INDEX movies_title_idx ON movies (title, id);
+CREATE INDEX movies_created_at_idx ON movies (created_at, id);
+CREATE INDEX movies_director_id_idx ON movies (director_id);
+CREATE INDEX movie_categories_category_id_idx ON movie_categories (category_id);
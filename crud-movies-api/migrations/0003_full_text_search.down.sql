@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS categories_search_idx;
+DROP INDEX IF EXISTS directors_search_idx;
+DROP INDEX IF EXISTS movies_search_idx;
+
+ALTER TABLE categories DROP COLUMN search_vector;
+ALTER TABLE directors DROP COLUMN search_vector;
+ALTER TABLE movies DROP COLUMN search_vector;
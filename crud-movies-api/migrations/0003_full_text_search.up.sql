@@ -0,0 +1,15 @@
+-- Generated columns cannot reach across tables, so each searchable table
+-- carries its own weighted vector: titles rank above director names, which
+-- rank above category names.
+ALTER TABLE movies ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('english', coalesce(title, '')), 'A')) STORED;
+
+ALTER TABLE directors ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('english', coalesce(firstname, '') || ' ' || coalesce(lastname, '')), 'B')) STORED;
+
+ALTER TABLE categories ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (setweight(to_tsvector('english', coalesce(name, '')), 'C')) STORED;
+
+CREATE INDEX movies_search_idx ON movies USING GIN (search_vector);
+CREATE INDEX directors_search_idx ON directors USING GIN (search_vector);
+CREATE INDEX categories_search_idx ON categories USING GIN (search_vector);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS categories_name_trgm_idx;
+DROP INDEX IF EXISTS directors_name_trgm_idx;
+DROP INDEX IF EXISTS movies_title_trgm_idx;
+
+-- The extension is left installed; other objects may depend on it.
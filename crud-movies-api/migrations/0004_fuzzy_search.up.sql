@@ -0,0 +1,8 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Trigram indexes serve the <% (word similarity) operator used for
+-- typo-tolerant matching and "did you mean" suggestions. The director
+-- expression must match the one used in queries exactly.
+CREATE INDEX movies_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
+CREATE INDEX directors_name_trgm_idx ON directors USING GIN ((firstname || ' ' || lastname) gin_trgm_ops);
+CREATE INDEX categories_name_trgm_idx ON categories USING GIN (name gin_trgm_ops);
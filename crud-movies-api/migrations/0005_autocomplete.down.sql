@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS categories_name_prefix_idx;
+DROP INDEX IF EXISTS directors_lastname_prefix_idx;
+DROP INDEX IF EXISTS directors_firstname_prefix_idx;
+DROP INDEX IF EXISTS movies_title_prefix_idx;
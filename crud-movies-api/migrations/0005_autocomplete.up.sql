@@ -0,0 +1,6 @@
+-- Prefix lookups for GET /autocomplete. Matches at the start of later
+-- words are served by the trigram indexes from 0004.
+CREATE INDEX movies_title_prefix_idx ON movies (lower(title) text_pattern_ops);
+CREATE INDEX directors_firstname_prefix_idx ON directors (lower(firstname) text_pattern_ops);
+CREATE INDEX directors_lastname_prefix_idx ON directors (lower(lastname) text_pattern_ops);
+CREATE INDEX categories_name_prefix_idx ON categories (lower(name) text_pattern_ops);
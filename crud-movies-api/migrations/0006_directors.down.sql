@@ -0,0 +1 @@
+DROP INDEX IF EXISTS directors_name_key;
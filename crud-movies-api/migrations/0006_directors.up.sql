@@ -0,0 +1,17 @@
+-- Directors become a resource of their own, identified by name. Fold
+-- directors sharing a name into the oldest one before enforcing that.
+UPDATE movies m
+SET director_id = keep.id
+FROM directors d
+JOIN (
+    SELECT min(id) AS id, firstname, lastname
+    FROM directors
+    GROUP BY firstname, lastname
+) keep ON keep.firstname = d.firstname AND keep.lastname = d.lastname
+WHERE m.director_id = d.id AND d.id <> keep.id;
+
+DELETE FROM directors d
+USING directors keep
+WHERE keep.firstname = d.firstname AND keep.lastname = d.lastname AND keep.id < d.id;
+
+CREATE UNIQUE INDEX directors_name_key ON directors (firstname, lastname);
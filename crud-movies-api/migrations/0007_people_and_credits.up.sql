@@ -0,0 +1,22 @@
+-- Directors generalize to people credited on movies in any role. Indexes
+-- keep their directors_* names so earlier down migrations still apply.
+ALTER TABLE directors RENAME TO people;
+
+-- movies.director_id stays as the primary director; every director,
+-- including that one, is also credited here. position orders a movie's
+-- credits as they were given.
+CREATE TABLE movie_credits (
+    movie_id INTEGER NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    person_id INTEGER NOT NULL REFERENCES people(id),
+    role TEXT NOT NULL CONSTRAINT movie_credits_role_check
+        CHECK (role IN ('director', 'writer', 'producer', 'composer', 'cinematographer')),
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (movie_id, person_id, role)
+);
+
+CREATE INDEX movie_credits_person_idx ON movie_credits (person_id, role);
+
+INSERT INTO movie_credits (movie_id, person_id, role)
+SELECT id, director_id, 'director'
+FROM movies
+WHERE director_id IS NOT NULL;
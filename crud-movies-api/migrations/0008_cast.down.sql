@@ -0,0 +1,2 @@
+DROP VIEW IF EXISTS movie_people;
+DROP TABLE IF EXISTS movie_cast;
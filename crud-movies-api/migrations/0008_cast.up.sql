@@ -0,0 +1,17 @@
+-- Actors and the characters they play, in billing order from 1. The same
+-- person may play several characters.
+CREATE TABLE movie_cast (
+    movie_id INTEGER NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    person_id INTEGER NOT NULL REFERENCES people(id),
+    character TEXT NOT NULL DEFAULT '',
+    billing INTEGER NOT NULL,
+    PRIMARY KEY (movie_id, billing)
+);
+
+CREATE INDEX movie_cast_person_idx ON movie_cast (person_id);
+
+-- Everyone credited on a movie, in any role or in the cast.
+CREATE VIEW movie_people AS
+SELECT movie_id, person_id FROM movie_credits
+UNION
+SELECT movie_id, person_id FROM movie_cast;
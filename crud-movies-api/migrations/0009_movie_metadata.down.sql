@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS movies_content_rating_idx;
+DROP INDEX IF EXISTS movies_countries_idx;
+DROP INDEX IF EXISTS movies_original_language_idx;
+DROP INDEX IF EXISTS movies_runtime_idx;
+DROP INDEX IF EXISTS movies_year_idx;
+ALTER TABLE movies DROP COLUMN content_rating;
+ALTER TABLE movies DROP COLUMN countries;
+ALTER TABLE movies DROP COLUMN original_language;
+ALTER TABLE movies DROP COLUMN synopsis;
+ALTER TABLE movies DROP COLUMN runtime;
+ALTER TABLE movies DROP COLUMN release_date;
@@ -0,0 +1,16 @@
+-- Descriptive metadata. Codes are stored as validated by the API: ISO 639-1
+-- languages in lower case, ISO 3166-1 alpha-2 countries in upper case.
+ALTER TABLE movies ADD COLUMN release_date DATE;
+ALTER TABLE movies ADD COLUMN runtime INTEGER CHECK (runtime > 0);
+ALTER TABLE movies ADD COLUMN synopsis TEXT NOT NULL DEFAULT '';
+ALTER TABLE movies ADD COLUMN original_language TEXT;
+ALTER TABLE movies ADD COLUMN countries TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE movies ADD COLUMN content_rating TEXT
+    CHECK (content_rating IN ('G', 'PG', 'PG-13', 'R', 'NC-17', 'NR'));
+
+-- Support the new filters and the runtime sort of GET /movies.
+CREATE INDEX movies_year_idx ON movies (year, id);
+CREATE INDEX movies_runtime_idx ON movies (runtime, id);
+CREATE INDEX movies_original_language_idx ON movies (original_language);
+CREATE INDEX movies_countries_idx ON movies USING GIN (countries);
+CREATE INDEX movies_content_rating_idx ON movies (content_rating);
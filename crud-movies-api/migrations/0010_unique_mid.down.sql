@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movies_mid_key;
+ALTER TABLE movies ALTER COLUMN mid DROP NOT NULL;
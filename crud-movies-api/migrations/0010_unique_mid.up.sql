@@ -0,0 +1,14 @@
+-- MIDs become unique, server-owned identifiers. Movies without one get a
+-- MID derived from their id; repeats of a MID after the oldest get the
+-- same -2, -3, ... suffixes the API now adds.
+UPDATE movies
+SET mid = substr(md5('movie:' || id), 1, 4) || '-' || substr(md5('movie:' || id), 5, 4) || '-' || substr(md5('movie:' || id), 9, 2)
+WHERE mid IS NULL OR mid = '';
+
+UPDATE movies m
+SET mid = m.mid || '-' || dup.n
+FROM (SELECT id, row_number() OVER (PARTITION BY mid ORDER BY id) AS n FROM movies) dup
+WHERE dup.id = m.id AND dup.n > 1;
+
+ALTER TABLE movies ALTER COLUMN mid SET NOT NULL;
+CREATE UNIQUE INDEX movies_mid_key ON movies (mid);
@@ -0,0 +1,3 @@
+-- Categories nest: a category without a parent is a root.
+ALTER TABLE categories ADD COLUMN parent_id INTEGER REFERENCES categories(id);
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
@@ -0,0 +1,6 @@
+-- Presentation details. Colors are stored as validated by the API: #rrggbb
+-- in lower case. Categories are listed by sort_order, then by name.
+ALTER TABLE categories ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN color TEXT CHECK (color ~ '^#[0-9a-f]{6}$');
+ALTER TABLE categories ADD COLUMN icon TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DELETE FROM categories WHERE rules IS NOT NULL;
+ALTER TABLE categories DROP COLUMN rules;
@@ -0,0 +1,3 @@
+-- Smart categories hold the rules selecting their movies instead of
+-- movie_categories rows; regular categories have no rules.
+ALTER TABLE categories ADD COLUMN rules JSONB;
@@ -0,0 +1,2 @@
+DROP TABLE movie_tags;
+DROP TABLE tags;
@@ -0,0 +1,19 @@
+-- Free-form labels, created as movies name them. Names are unique
+-- regardless of case and kept as first written.
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    search_vector tsvector
+        GENERATED ALWAYS AS (setweight(to_tsvector('english', name), 'C')) STORED
+);
+
+CREATE UNIQUE INDEX tags_name_key ON tags (lower(name));
+CREATE INDEX tags_search_idx ON tags USING GIN (search_vector);
+
+CREATE TABLE movie_tags (
+    movie_id INTEGER NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id),
+    PRIMARY KEY (movie_id, tag_id)
+);
+
+CREATE INDEX movie_tags_tag_id_idx ON movie_tags (tag_id);
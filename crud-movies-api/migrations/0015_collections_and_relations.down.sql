@@ -0,0 +1,3 @@
+DROP TABLE movie_relations;
+DROP TABLE collection_movies;
+DROP TABLE collections;
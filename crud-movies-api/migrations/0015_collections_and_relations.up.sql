@@ -0,0 +1,30 @@
+-- Named, ordered lists of movies, such as the films of a series.
+CREATE TABLE collections (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX collections_name_key ON collections (lower(name));
+
+CREATE TABLE collection_movies (
+    collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    movie_id INTEGER NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, movie_id)
+);
+
+CREATE INDEX collection_movies_movie_id_idx ON collection_movies (movie_id);
+
+-- "movie_id is <kind> related_id". Inverse kinds such as prequel_of are
+-- stored as the kind they invert, with the movies swapped.
+CREATE TABLE movie_relations (
+    movie_id INTEGER NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CONSTRAINT movie_relations_kind_check
+        CHECK (kind IN ('sequel_of', 'remake_of', 'spin_off_of')),
+    related_id INTEGER NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    PRIMARY KEY (movie_id, kind, related_id),
+    CHECK (movie_id <> related_id)
+);
+
+CREATE INDEX movie_relations_related_id_idx ON movie_relations (related_id);
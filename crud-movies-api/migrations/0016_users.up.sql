@@ -0,0 +1,19 @@
+-- Accounts that may change the catalogue. Usernames are unique regardless
+-- of case; passwords are kept as bcrypt hashes.
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX users_username_key ON users (lower(username));
+
+-- Logged-in sessions, by the SHA-256 of the token handed to the client.
+CREATE TABLE sessions (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,6 @@
+-- Roles granted beyond viewer, which every user has.
+CREATE TABLE user_roles (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CONSTRAINT user_roles_role_check CHECK (role IN ('editor', 'admin')),
+    PRIMARY KEY (user_id, role)
+);
@@ -0,0 +1,10 @@
+-- Users without a password could no longer log in.
+DELETE FROM users WHERE password_hash IS NULL;
+
+DROP INDEX users_oidc_key;
+
+ALTER TABLE users
+    DROP CONSTRAINT users_login_check,
+    DROP COLUMN oidc_subject,
+    DROP COLUMN oidc_issuer,
+    ALTER COLUMN password_hash SET NOT NULL;
@@ -0,0 +1,9 @@
+-- Users who log in through an OpenID Connect provider, known to it by
+-- subject, have no password here.
+ALTER TABLE users
+    ALTER COLUMN password_hash DROP NOT NULL,
+    ADD COLUMN oidc_issuer TEXT,
+    ADD COLUMN oidc_subject TEXT,
+    ADD CONSTRAINT users_login_check CHECK (password_hash IS NOT NULL OR oidc_subject IS NOT NULL);
+
+CREATE UNIQUE INDEX users_oidc_key ON users (oidc_issuer, oidc_subject) WHERE oidc_subject IS NOT NULL;
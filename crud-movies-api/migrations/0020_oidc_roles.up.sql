@@ -0,0 +1,3 @@
+-- Roles an OIDC provider granted, which a later login may take away again.
+-- Roles granted here are never touched by the provider.
+ALTER TABLE user_roles ADD COLUMN from_oidc BOOLEAN NOT NULL DEFAULT false;
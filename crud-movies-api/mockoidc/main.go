@@ -0,0 +1,310 @@
+// Command mockoidc is a minimal OpenID Connect provider for trying the
+// API's OIDC login locally. It approves every login as one configured
+// user, without asking, and signs tokens with a key generated at startup.
+//
+//	go run ./mockoidc -roles movies-admins
+//
+// then start the API with OIDC_ISSUER=http://localhost:9000,
+// OIDC_CLIENT_ID=movies, OIDC_AUDIENCE=movies-api,
+// OIDC_REDIRECT_URL=http://localhost:8000/auth/oidc/callback and
+// OIDC_ROLE_MAP=movies-admins=admin, and open /auth/oidc/login. GET
+// /mock/token returns an access token for calling the API directly.
+//
+// As with real providers, ID tokens are issued for the client and access
+// tokens for the API, so that neither passes for the other.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+const keyID = "mock"
+
+// provider holds the signing key and the codes issued but not redeemed.
+type provider struct {
+	issuer   string
+	clientID string
+	audience string
+	user     identity
+	key      *rsa.PrivateKey
+	// Access tokens are typed "at+jwt", as RFC 9068 has it.
+	idSigner     jose.Signer
+	accessSigner jose.Signer
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+// identity is who logins are approved as.
+type identity struct {
+	Subject  string
+	Username string
+	Email    string
+	Roles    []string
+}
+
+// pendingCode is an authorization code awaiting exchange.
+type pendingCode struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	user        identity
+	expires     time.Time
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, as clients reach this server")
+	clientID := flag.String("client-id", "movies", "client ID to issue ID tokens for")
+	audience := flag.String("audience", "movies-api", "audience to issue access tokens for")
+	subject := flag.String("sub", "mock-user", "subject of the logged-in user")
+	username := flag.String("username", "mockuser", "preferred_username of the logged-in user")
+	email := flag.String("email", "mockuser@example.com", "email of the logged-in user")
+	roles := flag.String("roles", "", "comma-separated roles claim of the logged-in user")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signingKey := jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: keyID}}
+	idSigner, err := jose.NewSigner(signingKey, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	accessSigner, err := jose.NewSigner(signingKey, (&jose.SignerOptions{}).WithType("at+jwt"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := &provider{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		audience:     *audience,
+		user:         identity{Subject: *subject, Username: *username, Email: *email, Roles: splitList(*roles)},
+		key:          key,
+		idSigner:     idSigner,
+		accessSigner: accessSigner,
+		codes:        make(map[string]pendingCode),
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	http.HandleFunc("/jwks", p.jwks)
+	http.HandleFunc("/authorize", p.authorize)
+	http.HandleFunc("/token", p.token)
+	http.HandleFunc("/mock/token", p.mockToken)
+
+	log.Printf("Mock OIDC provider %s listening on %s", p.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func splitList(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// tokenError responds with an OAuth 2.0 error.
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"grant_types_supported":                 []string{"authorization_code"},
+	})
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &p.key.PublicKey, KeyID: keyID, Algorithm: "RS256", Use: "sig"},
+	}})
+}
+
+// authorize approves the login at once and redirects back with a code.
+// Only S256 PKCE challenges are accepted.
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("client_id") != p.clientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	back := redirectURI.Query()
+	back.Set("state", q.Get("state"))
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		back.Set("error", "invalid_request")
+		back.Set("error_description", "a code response with an S256 code_challenge is required")
+	} else {
+		code := randomString()
+		p.mu.Lock()
+		p.codes[code] = pendingCode{
+			redirectURI: q.Get("redirect_uri"),
+			challenge:   q.Get("code_challenge"),
+			nonce:       q.Get("nonce"),
+			user:        p.user,
+			expires:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		back.Set("code", code)
+	}
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems an authorization code, checking its PKCE verifier.
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+	if !ok || time.Now().After(code.expires) || code.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		tokenError(w, "invalid_grant", "code_verifier does not match code_challenge")
+		return
+	}
+
+	idToken, err := p.signIDToken(code.user, code.nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := p.signAccessToken(code.user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"id_token":     idToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+// mockToken returns an access token for the configured user, or the one
+// given by ?sub=, ?username= and ?roles=, without a login.
+func (p *provider) mockToken(w http.ResponseWriter, r *http.Request) {
+	user := p.user
+	q := r.URL.Query()
+	if v := q.Get("sub"); v != "" {
+		user.Subject = v
+	}
+	if v := q.Get("username"); v != "" {
+		user.Username = v
+	}
+	if q.Has("roles") {
+		user.Roles = splitList(q.Get("roles"))
+	}
+
+	accessToken, err := p.signAccessToken(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+// signIDToken issues an ID token for the client, carrying nonce.
+func (p *provider) signIDToken(user identity, nonce string) (string, error) {
+	claims := p.claims(user, p.clientID)
+	claims["nonce"] = nonce
+	return sign(p.idSigner, claims)
+}
+
+// signAccessToken issues an access token for the API.
+func (p *provider) signAccessToken(user identity) (string, error) {
+	claims := p.claims(user, p.audience)
+	claims["client_id"] = p.clientID
+	return sign(p.accessSigner, claims)
+}
+
+// claims returns the claims of a token for user and audience, valid for an
+// hour.
+func (p *provider) claims(user identity, audience string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":                p.issuer,
+		"sub":                user.Subject,
+		"aud":                audience,
+		"azp":                p.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"preferred_username": user.Username,
+		"email":              user.Email,
+		"roles":              user.Roles,
+	}
+}
+
+func sign(signer jose.Signer, claims map[string]interface{}) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *server) getMovies(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := s.store.ListMovies(r.Context(), opts)
+	if err != nil {
+		log.Printf("Error fetching movies: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeMoviePage(w, page)
+}
+
+func (s *server) getMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid movie id", http.StatusBadRequest)
+		return
+	}
+	s.writeMovie(w, r, id)
+}
+
+// getMovieByMID looks a movie up by its MID, which unlike its id is meant
+// for other systems to keep.
+func (s *server) getMovieByMID(w http.ResponseWriter, r *http.Request) {
+	mid := mux.Vars(r)["mid"]
+	movie, err := s.store.GetMovieByMID(r.Context(), mid)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching movie %s: %v", mid, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, movie)
+}
+
+// searchResponse is the body of GET /movies/search.
+type searchResponse struct {
+	Results    []Movie `json:"results"`
+	Total      int     `json:"total"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	// Suggestions are offered when nothing matched.
+	Suggestions []string `json:"suggestions,omitempty"`
+	// Facets counts every match, not just this page, by the facets the
+	// request asked for.
+	Facets Facets `json:"facets,omitempty"`
+}
+
+func (s *server) searchMovies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		log.Println("Empty search query")
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	sq, err := parseSearchQuery(query)
+	var qerr *QueryError
+	if errors.As(err, &qerr) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":    qerr.Msg,
+			"position": qerr.Pos,
+			"token":    qerr.Token,
+		})
+		return
+	}
+	sq.Similarity = s.searchSimilarity
+	if v := r.URL.Query().Get("fuzzy"); v != "" {
+		fuzzy, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "fuzzy must be true or false", http.StatusBadRequest)
+			return
+		}
+		if !fuzzy {
+			sq.Similarity = 0
+		}
+	}
+
+	opts, err := parseListOptions(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Searching for movies with query: %s", query)
+	page, err := s.store.SearchMovies(r.Context(), sq, opts)
+	if err != nil {
+		log.Printf("Error executing search query: %v", err)
+		http.Error(w, "Internal server error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Found %d movies matching query: %s", page.Total, query)
+
+	resp := searchResponse{Results: page.Movies, Total: page.Total, NextCursor: page.NextCursor, Facets: page.Facets}
+	if resp.Results == nil {
+		resp.Results = []Movie{}
+	}
+	if page.Total == 0 && len(sq.textTerms()) > 0 {
+		resp.Suggestions, err = s.store.SuggestQueries(r.Context(), sq.fuzzyText(), s.suggestSimilarity, maxSuggestions)
+		if err != nil {
+			// Suggestions are a nicety; still answer the search.
+			log.Printf("Error fetching search suggestions: %v", err)
+		}
+	}
+
+	setPageHeaders(w, page)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *server) createMovie(w http.ResponseWriter, r *http.Request) {
+	var movie Movie
+	if err := json.NewDecoder(r.Body).Decode(&movie); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := normalizeCredits(&movie); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateMovie(&movie); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// MIDs are owned by the server; the store keeps them unique.
+	movie.MID = generateMID(movie)
+
+	err := s.store.CreateMovie(r.Context(), &movie)
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating movie: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, movie)
+}
+
+func (s *server) updateMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid movie id", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Updating movie with ID: %d", id)
+
+	var movie Movie
+	if err := json.NewDecoder(r.Body).Decode(&movie); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := normalizeCredits(&movie); err != nil {
+		log.Printf("Movie validation failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateMovie(&movie); err != nil {
+		log.Printf("Movie validation failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.UpdateMovie(r.Context(), id, &movie)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating movie: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if s.autoCleanupCategories {
+		if err = s.store.CleanupEmptyCategories(r.Context()); err != nil {
+			log.Printf("Error cleaning up empty categories: %v", err)
+		}
+	}
+
+	log.Println("Movie updated successfully")
+	writeJSON(w, http.StatusOK, movie)
+}
+
+func (s *server) deleteMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid movie id", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.DeleteMovie(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting movie: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if s.autoCleanupCategories {
+		if err = s.store.CleanupEmptyCategories(r.Context()); err != nil {
+			log.Printf("Error cleaning up empty categories: %v", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Movie deleted successfully"})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcConfig configures login through an OpenID Connect provider, from the
+// OIDC_* environment variables.
+type oidcConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for a public client, which PKCE protects
+	RedirectURL  string // this API's /auth/oidc/callback
+	Scopes       []string
+	// Audience is what bearer access tokens must be issued for. It must
+	// differ from the client ID, which ID tokens are issued for, so that an
+	// ID token cannot pass for an access token.
+	Audience string
+	// UsernameClaim names new users; RolesClaim, a dotted path such as
+	// realm_access.roles, lists the provider's roles, which RoleMap maps to
+	// local ones when users log in. Without RoleMap, roles are only
+	// granted locally.
+	UsernameClaim string
+	RolesClaim    string
+	RoleMap       map[string]string
+}
+
+// oidcConfigFromEnv returns the configuration, or nil when OIDC_ISSUER is
+// unset and OIDC login is off.
+func oidcConfigFromEnv() (*oidcConfig, error) {
+	c := &oidcConfig{
+		Issuer:        os.Getenv("OIDC_ISSUER"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        []string{oidc.ScopeOpenID, "profile", "email"},
+		Audience:      os.Getenv("OIDC_AUDIENCE"),
+		UsernameClaim: "preferred_username",
+		RolesClaim:    "roles",
+	}
+	if c.Issuer == "" {
+		return nil, nil
+	}
+	if c.ClientID == "" || c.RedirectURL == "" || c.Audience == "" {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID, OIDC_REDIRECT_URL and OIDC_AUDIENCE are required with OIDC_ISSUER")
+	}
+	if c.Audience == c.ClientID {
+		return nil, fmt.Errorf("OIDC_AUDIENCE must be the API's audience, not OIDC_CLIENT_ID, or ID tokens would be accepted as access tokens")
+	}
+	if v := os.Getenv("OIDC_SCOPES"); v != "" {
+		c.Scopes = strings.Fields(v)
+	}
+	if v := os.Getenv("OIDC_USERNAME_CLAIM"); v != "" {
+		c.UsernameClaim = v
+	}
+	if v := os.Getenv("OIDC_ROLES_CLAIM"); v != "" {
+		c.RolesClaim = v
+	}
+
+	// OIDC_ROLE_MAP reads "movies-admins=admin,movies-editors=editor".
+	if v := os.Getenv("OIDC_ROLE_MAP"); v != "" {
+		c.RoleMap = make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			external, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !grantableRole(role) {
+				return nil, fmt.Errorf("OIDC_ROLE_MAP: expected provider-role=%s or %s, got %q", roleEditor, roleAdmin, pair)
+			}
+			c.RoleMap[external] = role
+		}
+	}
+	return c, nil
+}
+
+// oidcAuth logs users in through the configured provider and accepts the
+// access tokens it issues.
+type oidcAuth struct {
+	config       oidcConfig
+	oauth2       oauth2.Config
+	idTokens     *oidc.IDTokenVerifier
+	accessTokens *oidc.IDTokenVerifier
+}
+
+// newOIDCAuth discovers the provider's endpoints and signing keys.
+func newOIDCAuth(ctx context.Context, c oidcConfig) (*oidcAuth, error) {
+	provider, err := oidc.NewProvider(ctx, c.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	return &oidcAuth{
+		config: c,
+		oauth2: oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       c.Scopes,
+		},
+		idTokens:     provider.Verifier(&oidc.Config{ClientID: c.ClientID}),
+		accessTokens: provider.Verifier(&oidc.Config{ClientID: c.Audience}),
+	}, nil
+}
+
+// isJWT reports whether a bearer token is shaped like a JWT, as the
+// provider's access tokens are and session tokens are not.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// user returns the local user a verified token is for, creating them on
+// first sight.
+func (a *oidcAuth) user(ctx context.Context, store UserStore, token *oidc.IDToken) (User, error) {
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return User{}, err
+	}
+
+	username, _ := claimValue(claims, a.config.UsernameClaim).(string)
+	if username == "" {
+		username, _ = claims["email"].(string)
+	}
+	if username == "" {
+		username = token.Subject
+	}
+	return store.OIDCUser(ctx, token.Issuer, token.Subject, username)
+}
+
+// syncRoles updates the roles the provider grants user from the claims of
+// the ID token they logged in with. Without a RoleMap it leaves them be.
+func (a *oidcAuth) syncRoles(ctx context.Context, store UserStore, user User, token *oidc.IDToken) (User, error) {
+	if a.config.RoleMap == nil {
+		return user, nil
+	}
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return User{}, err
+	}
+
+	roles := []string{}
+	seen := make(map[string]bool)
+	for _, external := range claimStrings(claimValue(claims, a.config.RolesClaim)) {
+		if role, ok := a.config.RoleMap[external]; ok && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	sortRoles(roles)
+	return store.SyncOIDCRoles(ctx, user.ID, roles)
+}
+
+// claimValue follows a dotted path such as realm_access.roles into claims.
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var v interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// claimStrings reads a claim holding a list of strings, or a single
+// space-separated string as scope claims are.
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
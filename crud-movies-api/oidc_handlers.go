@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// oidcLoginCookie carries a login's state, PKCE verifier and nonce from
+// oidcLogin to oidcCallback.
+const oidcLoginCookie = "oidc_login"
+
+// oidcLoginState is the content of oidcLoginCookie.
+type oidcLoginState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// oidcLogin redirects the browser to the provider to log in, with an
+// authorization code request protected by PKCE.
+func (s *server) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	state, _, err := newToken()
+	if err != nil {
+		log.Printf("Error generating OIDC state: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, _, err := newToken()
+	if err != nil {
+		log.Printf("Error generating OIDC nonce: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	login := oidcLoginState{State: state, Verifier: oauth2.GenerateVerifier(), Nonce: nonce}
+
+	value, _ := json.Marshal(login)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/auth/oidc/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.oidc.config.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	url := s.oidc.oauth2.AuthCodeURL(login.State, oauth2.S256ChallengeOption(login.Verifier), oidc.Nonce(login.Nonce))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// oidcCallback completes a login the provider redirected back: it
+// exchanges the code, verifies the ID token and responds like a password
+// login, with a session for the local user the token maps to.
+func (s *server) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		unauthorized(w, "Login failed: "+strings.TrimSpace(e+" "+q.Get("error_description")))
+		return
+	}
+
+	var login oidcLoginState
+	cookie, err := r.Cookie(oidcLoginCookie)
+	if err == nil {
+		var value []byte
+		if value, err = base64.RawURLEncoding.DecodeString(cookie.Value); err == nil {
+			err = json.Unmarshal(value, &login)
+		}
+	}
+	if err != nil || login.State == "" || q.Get("state") != login.State {
+		http.Error(w, "Login expired or was started elsewhere; try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcLoginCookie, Path: "/auth/oidc/", MaxAge: -1})
+
+	token, err := s.oidc.oauth2.Exchange(r.Context(), q.Get("code"), oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		log.Printf("Error exchanging OIDC code: %v", err)
+		unauthorized(w, "Login failed: the authorization code was rejected")
+		return
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	idToken, err := s.oidc.idTokens.Verify(r.Context(), rawIDToken)
+	if err != nil || idToken.Nonce != login.Nonce {
+		unauthorized(w, "Login failed: invalid ID token")
+		return
+	}
+
+	user, err := s.oidc.user(r.Context(), s.store, idToken)
+	if err == nil {
+		user, err = s.oidc.syncRoles(r.Context(), s.store, user, idToken)
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up OIDC user: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.startSession(w, r, user)
+}
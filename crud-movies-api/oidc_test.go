@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v3"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testClientID = "movies"
+	testAudience = "movies-api"
+)
+
+// testProvider signs tokens as an OIDC provider would.
+type testProvider struct {
+	t      *testing.T
+	key    *rsa.PrivateKey
+	signer jose.Signer
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testProvider{t: t, key: key, signer: signer}
+}
+
+// auth returns an oidcAuth trusting the provider, mapping its groups
+// claim through roleMap.
+func (p *testProvider) auth(roleMap map[string]string) *oidcAuth {
+	keys := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&p.key.PublicKey}}
+	return &oidcAuth{
+		config: oidcConfig{
+			Issuer:        testIssuer,
+			ClientID:      testClientID,
+			Audience:      testAudience,
+			UsernameClaim: "preferred_username",
+			RolesClaim:    "groups",
+			RoleMap:       roleMap,
+		},
+		idTokens:     oidc.NewVerifier(testIssuer, keys, &oidc.Config{ClientID: testClientID}),
+		accessTokens: oidc.NewVerifier(testIssuer, keys, &oidc.Config{ClientID: testAudience}),
+	}
+}
+
+// token signs a token for subject, issued for audience, with groups.
+func (p *testProvider) token(audience, subject string, groups ...string) string {
+	p.t.Helper()
+	payload, err := json.Marshal(map[string]interface{}{
+		"iss":                testIssuer,
+		"sub":                subject,
+		"aud":                audience,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"preferred_username": subject,
+		"groups":             groups,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	jws, err := p.signer.Sign(payload)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return token
+}
+
+// login does what a login through the provider does once its ID token is
+// verified.
+func (p *testProvider) login(auth *oidcAuth, store UserStore, subject string, groups ...string) User {
+	p.t.Helper()
+	ctx := context.Background()
+	idToken, err := auth.idTokens.Verify(ctx, p.token(testClientID, subject, groups...))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	user, err := auth.user(ctx, store, idToken)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if user, err = auth.syncRoles(ctx, store, user, idToken); err != nil {
+		p.t.Fatal(err)
+	}
+	return user
+}
+
+func TestOIDCBearerTokens(t *testing.T) {
+	ts := newTestServer(t)
+	p := newTestProvider(t)
+	ts.srv.oidc = p.auth(map[string]string{"movie-admins": roleAdmin})
+
+	// ID tokens are issued for the client, not the API.
+	idToken := p.token(testClientID, "ripley", "movie-admins")
+	ts.expect(ts.do("GET", "/auth/me", idToken, nil), http.StatusUnauthorized, nil)
+
+	accessToken := p.token(testAudience, "ripley", "movie-admins")
+	me := ts.me(accessToken)
+	if me.Username != "ripley" {
+		t.Errorf("me = %+v", me)
+	}
+	// Roles follow logins, not every request.
+	if len(me.Roles) != 0 {
+		t.Errorf("a bearer request granted roles %q", me.Roles)
+	}
+
+	user := p.login(ts.srv.oidc, ts.store, "ripley", "movie-admins")
+	if user.ID != me.ID || !reflect.DeepEqual(user.Roles, []string{roleAdmin}) {
+		t.Errorf("after login: %+v", user)
+	}
+	ts.expect(ts.do("GET", "/admin/users", accessToken, nil), http.StatusOK, nil)
+
+	// A token without the group no longer changes them either.
+	if me := ts.me(p.token(testAudience, "ripley")); !reflect.DeepEqual(me.Roles, []string{roleAdmin}) {
+		t.Errorf("a bearer request changed roles to %q", me.Roles)
+	}
+}
+
+func TestOIDCRoleSync(t *testing.T) {
+	store := newMemoryStore()
+	p := newTestProvider(t)
+	auth := p.auth(map[string]string{"movie-admins": roleAdmin, "movie-editors": roleEditor})
+	ctx := context.Background()
+
+	root, err := bootstrapAdmin(ctx, store, "root", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := p.login(auth, store, "ripley", "movie-editors", "movie-admins", "unmapped")
+	if !reflect.DeepEqual(user.Roles, []string{roleEditor, roleAdmin}) {
+		t.Fatalf("roles = %q", user.Roles)
+	}
+
+	// Losing a group takes away the role it granted.
+	if user = p.login(auth, store, "ripley", "movie-editors"); !reflect.DeepEqual(user.Roles, []string{roleEditor}) {
+		t.Errorf("roles = %q after leaving movie-admins", user.Roles)
+	}
+
+	// A role granted locally stays, whatever the provider says.
+	if _, err := store.GrantRole(ctx, user.ID, roleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if user = p.login(auth, store, "ripley"); !reflect.DeepEqual(user.Roles, []string{roleAdmin}) {
+		t.Errorf("roles = %q; the local admin grant must stay", user.Roles)
+	}
+	// Even if the provider granted it first.
+	p.login(auth, store, "ripley", "movie-editors")
+	if _, err := store.GrantRole(ctx, user.ID, roleEditor); err != nil {
+		t.Fatal(err)
+	}
+	if user = p.login(auth, store, "ripley"); !reflect.DeepEqual(user.Roles, []string{roleEditor, roleAdmin}) {
+		t.Errorf("roles = %q; the local editor grant must stay", user.Roles)
+	}
+
+	// The last admin keeps the role.
+	if _, err := store.RevokeRole(ctx, user.ID, roleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RevokeRole(ctx, root.ID, roleAdmin); err == nil {
+		t.Fatal("revoked the last admin")
+	}
+	if user = p.login(auth, store, "ripley", "movie-admins"); !hasRole(user, roleAdmin) {
+		t.Fatalf("roles = %q", user.Roles)
+	}
+	if _, err := store.RevokeRole(ctx, root.ID, roleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if user = p.login(auth, store, "ripley"); !hasRole(user, roleAdmin) {
+		t.Errorf("roles = %q; the last admin lost the role", user.Roles)
+	}
+
+	// Without a RoleMap, roles are left to GrantRole.
+	if user = p.login(p.auth(nil), store, "ripley"); !hasRole(user, roleAdmin) {
+		t.Errorf("roles = %q without a RoleMap", user.Roles)
+	}
+}
+
+func TestOIDCConfigFromEnv(t *testing.T) {
+	set := func(issuer, audience string) {
+		t.Setenv("OIDC_ISSUER", issuer)
+		t.Setenv("OIDC_CLIENT_ID", testClientID)
+		t.Setenv("OIDC_REDIRECT_URL", "http://localhost:8000/auth/oidc/callback")
+		t.Setenv("OIDC_AUDIENCE", audience)
+		t.Setenv("OIDC_ROLE_MAP", "")
+	}
+
+	set("", "")
+	if c, err := oidcConfigFromEnv(); c != nil || err != nil {
+		t.Errorf("without OIDC_ISSUER: %+v, %v", c, err)
+	}
+
+	for _, audience := range []string{"", testClientID} {
+		set(testIssuer, audience)
+		if _, err := oidcConfigFromEnv(); err == nil {
+			t.Errorf("OIDC_AUDIENCE %q: want an error", audience)
+		}
+	}
+
+	set(testIssuer, testAudience)
+	t.Setenv("OIDC_ROLE_MAP", "movie-admins=admin, movie-editors=editor")
+	c, err := oidcConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"movie-admins": roleAdmin, "movie-editors": roleEditor}
+	if c.Audience != testAudience || !reflect.DeepEqual(c.RoleMap, want) {
+		t.Errorf("config = %+v", c)
+	}
+
+	t.Setenv("OIDC_ROLE_MAP", "movie-viewers=viewer")
+	if _, err := oidcConfigFromEnv(); err == nil {
+		t.Error("mapped a role that cannot be granted")
+	}
+}
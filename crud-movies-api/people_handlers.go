@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+)
+
+// getMoviesByPerson lists every movie a person is credited or cast on, with
+// the same paging, sorting and filters as GET /movies.
+func (s *server) getMoviesByPerson(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid person id", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseListOptions(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.PersonID = id
+
+	if _, err := s.store.GetDirector(r.Context(), id); errors.Is(err, ErrNotFound) {
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching person %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page, err := s.store.ListMovies(r.Context(), opts)
+	if err != nil {
+		log.Printf("Error fetching movies by person: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeMoviePage(w, page)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Roles, from least to most privileged. Each includes the ones before it,
+// and every user is a viewer; the others are granted.
+const (
+	roleViewer = "viewer"
+	roleEditor = "editor"
+	roleAdmin  = "admin"
+)
+
+var roleRanks = map[string]int{roleViewer: 0, roleEditor: 1, roleAdmin: 2}
+
+// grantableRole reports whether role can be granted and revoked.
+func grantableRole(role string) bool {
+	return role == roleEditor || role == roleAdmin
+}
+
+// hasRole reports whether user holds role or a more privileged one.
+func hasRole(user User, role string) bool {
+	if role == roleViewer {
+		return true
+	}
+	for _, r := range user.Roles {
+		if roleRanks[r] >= roleRanks[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// sortRoles orders roles from least to most privileged.
+func sortRoles(roles []string) {
+	sort.Slice(roles, func(i, j int) bool { return roleRanks[roles[i]] < roleRanks[roles[j]] })
+}
+
+// routePolicy gives the least role each route takes, by method and path
+// template; "" opens a route to anonymous requests. Routes not listed take
+// an admin if they are under /admin/ or change anything, and are open to
+// anyone otherwise, so that a new endpoint is never left open by mistake.
+var routePolicy = map[string]string{
+	"POST /auth/register": "",
+	"POST /auth/login":    "",
+	"POST /auth/logout":   roleViewer,
+	"GET /auth/me":        roleViewer,
+
+	"POST /movies":                                   roleEditor,
+	"PUT /movies/{id}":                               roleEditor,
+	"POST /movies/{id}/relations":                    roleEditor,
+	"DELETE /movies/{id}/relations/{kind}/{related}": roleEditor,
+	"POST /directors":                                roleEditor,
+	"PUT /directors/{id}":                            roleEditor,
+	"POST /categories":                               roleEditor,
+	"PUT /categories/{id}":                           roleEditor,
+	"POST /categories/{id}/move":                     roleEditor,
+	"PUT /tags/{id}":                                 roleEditor,
+	"POST /collections":                              roleEditor,
+	"PUT /collections/{id}":                          roleEditor,
+
+	// Deleting and merging records, including cleanups, takes an admin.
+	"DELETE /movies/{id}":                       roleAdmin,
+	"DELETE /directors/{id}":                    roleAdmin,
+	"POST /directors/{id}/merge-into/{target}":  roleAdmin,
+	"POST /categories/cleanup":                  roleAdmin,
+	"DELETE /categories/{id}":                   roleAdmin,
+	"POST /categories/{id}/merge-into/{target}": roleAdmin,
+	"DELETE /tags/{id}":                         roleAdmin,
+	"POST /tags/{id}/merge-into/{target}":       roleAdmin,
+	"DELETE /collections/{id}":                  roleAdmin,
+	"GET /admin/users":                          roleAdmin,
+	"POST /admin/users/{id}/roles":              roleAdmin,
+	"DELETE /admin/users/{id}/roles/{role}":     roleAdmin,
+	"GET /admin/api-keys":                       roleAdmin,
+	"POST /admin/api-keys":                      roleAdmin,
+	"DELETE /admin/api-keys/{id}":               roleAdmin,
+}
+
+// requiredRole returns the least role the request's route takes, or "" if
+// anonymous requests may use it.
+func requiredRole(r *http.Request) string {
+	key := r.Method
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			key += " " + tmpl
+		}
+	}
+	if role, ok := routePolicy[key]; ok {
+		return role
+	}
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		return roleAdmin
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return ""
+	}
+	return roleAdmin
+}
+
+// AccessDenied is the body of a 403 response. Reason is
+// "insufficient_role", RequiredRole then being the role the route takes,
+// which an API key's owner must still hold; "insufficient_scope", for an
+// API key lacking RequiredScope; or "api_key_not_allowed", for a route
+// only users may call.
+type AccessDenied struct {
+	Reason        string   `json:"reason"`
+	Message       string   `json:"message"`
+	RequiredRole  string   `json:"required_role,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	RequiredScope string   `json:"required_scope,omitempty"`
+	Scopes        []string `json:"scopes,omitempty"`
+}
+
+// authorize enforces routePolicy on requests authenticate has let through
+// as a user or anonymously, and requiredScope on those made with an API
+// key.
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, ok := apiKeyFromContext(r.Context()); ok {
+			scope := requiredScope(r)
+			if scope == "" {
+				writeJSON(w, http.StatusForbidden, AccessDenied{
+					Reason:  "api_key_not_allowed",
+					Message: fmt.Sprintf("%s %s cannot be called with an API key", r.Method, r.URL.Path),
+				})
+				return
+			}
+			if !hasScope(key, scope) {
+				writeJSON(w, http.StatusForbidden, AccessDenied{
+					Reason:        "insufficient_scope",
+					Message:       fmt.Sprintf("%s %s requires the %s scope", r.Method, r.URL.Path, scope),
+					RequiredScope: scope,
+					Scopes:        key.Scopes,
+				})
+				return
+			}
+			s.authorizeKeyOwner(w, r, next, key)
+			return
+		}
+
+		role := requiredRole(r)
+		if role == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := userFromContext(r.Context())
+		if !ok {
+			unauthorized(w, "Authentication required")
+			return
+		}
+		if !hasRole(user, role) {
+			roles := append([]string{roleViewer}, user.Roles...)
+			writeJSON(w, http.StatusForbidden, AccessDenied{
+				Reason:       "insufficient_role",
+				Message:      fmt.Sprintf("%s %s requires the %s role", r.Method, r.URL.Path, role),
+				RequiredRole: role,
+				Roles:        roles,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeKeyOwner lets a request made with key through if the user who
+// created the key still holds the role the route takes, so that demoting
+// or deleting a user also takes power from their keys.
+func (s *server) authorizeKeyOwner(w http.ResponseWriter, r *http.Request, next http.Handler, key APIKey) {
+	role := requiredRole(r)
+	if role == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	var owner User
+	if key.CreatedBy != nil {
+		var err error
+		owner, err = s.store.GetUser(r.Context(), *key.CreatedBy)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("Error fetching owner of API key %d: %v", key.ID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err == nil && hasRole(owner, role) {
+			next.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	denied := AccessDenied{
+		Reason:       "insufficient_role",
+		Message:      fmt.Sprintf("%s %s requires the %s role, which the API key's owner does not hold", r.Method, r.URL.Path, role),
+		RequiredRole: role,
+	}
+	if owner.ID != 0 {
+		denied.Roles = append([]string{roleViewer}, owner.Roles...)
+	}
+	writeJSON(w, http.StatusForbidden, denied)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// routeKeys returns the "METHOD template" of every route of router.
+func routeKeys(t *testing.T, router *mux.Router) map[string]bool {
+	t.Helper()
+	keys := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, m := range methods {
+			keys[m+" "+tmpl] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestRoutePolicyMatchesRoutes(t *testing.T) {
+	keys := routeKeys(t, newServer(newMemoryStore()).routes())
+	for key := range routePolicy {
+		if !keys[key] {
+			t.Errorf("routePolicy lists %q, which is not a route", key)
+		}
+	}
+	for key := range keys {
+		if _, ok := routePolicy[key]; !ok && key[:4] != "GET " {
+			t.Errorf("%q is not in routePolicy and falls back to admin", key)
+		}
+	}
+}
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method, tmpl, path string
+		want               string
+	}{
+		{"GET", "/movies", "/movies", ""},
+		{"GET", "/movies/{id}", "/movies/7", ""},
+		{"POST", "/movies", "/movies", roleEditor},
+		{"PUT", "/movies/{id}", "/movies/7", roleEditor},
+		{"DELETE", "/movies/{id}", "/movies/7", roleAdmin},
+		{"POST", "/categories/{id}/merge-into/{target}", "/categories/1/merge-into/2", roleAdmin},
+		{"POST", "/auth/login", "/auth/login", ""},
+		{"GET", "/auth/me", "/auth/me", roleViewer},
+		{"GET", "/admin/users", "/admin/users", roleAdmin},
+		// Unlisted routes: open to read, admin-only to change or under
+		// /admin/.
+		{"GET", "/unlisted/{id}", "/unlisted/1", ""},
+		{"HEAD", "/unlisted/{id}", "/unlisted/1", ""},
+		{"POST", "/unlisted/{id}", "/unlisted/1", roleAdmin},
+		{"PATCH", "/movies/{id}", "/movies/7", roleAdmin},
+		{"GET", "/admin/unlisted", "/admin/unlisted", roleAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var got string
+			router := mux.NewRouter()
+			router.HandleFunc(tt.tmpl, func(w http.ResponseWriter, r *http.Request) {
+				got = requiredRole(r)
+			}).Methods(tt.method)
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			if got != tt.want {
+				t.Errorf("requiredRole = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		roles []string
+		role  string
+		want  bool
+	}{
+		{nil, roleViewer, true},
+		{nil, roleEditor, false},
+		{[]string{roleEditor}, roleEditor, true},
+		{[]string{roleEditor}, roleAdmin, false},
+		{[]string{roleAdmin}, roleEditor, true},
+		{[]string{roleEditor, roleAdmin}, roleAdmin, true},
+	}
+	for _, tt := range tests {
+		if got := hasRole(User{Roles: tt.roles}, tt.role); got != tt.want {
+			t.Errorf("hasRole(%v, %q) = %v, want %v", tt.roles, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorizeRoles(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+	editor := ts.login("editor", roleEditor)
+	viewer := ts.login("viewer")
+
+	ts.expect(ts.do("GET", "/movies", "", nil), http.StatusOK, nil)
+	ts.expect(ts.do("POST", "/movies", "", testMovie("Alien", 1979)), http.StatusUnauthorized, nil)
+	ts.expect(ts.do("POST", "/movies", "not-a-token", testMovie("Alien", 1979)), http.StatusUnauthorized, nil)
+
+	var denied AccessDenied
+	ts.expect(ts.do("POST", "/movies", viewer, testMovie("Alien", 1979)), http.StatusForbidden, &denied)
+	want := AccessDenied{
+		Reason:       "insufficient_role",
+		Message:      "POST /movies requires the editor role",
+		RequiredRole: roleEditor,
+		Roles:        []string{roleViewer},
+	}
+	if !reflect.DeepEqual(denied, want) {
+		t.Errorf("403 body = %+v, want %+v", denied, want)
+	}
+
+	movie := ts.createMovie(editor, testMovie("Alien", 1979))
+	ts.expect(ts.do("DELETE", "/movies/"+movie.ID, editor, nil), http.StatusForbidden, nil)
+	ts.expect(ts.do("GET", "/admin/users", editor, nil), http.StatusForbidden, nil)
+	ts.expect(ts.do("GET", "/admin/users", admin, nil), http.StatusOK, nil)
+	ts.expect(ts.do("DELETE", "/movies/"+movie.ID, admin, nil), http.StatusOK, nil)
+
+	var me User
+	ts.expect(ts.do("GET", "/auth/me", viewer, nil), http.StatusOK, &me)
+	if me.Username != "viewer" {
+		t.Errorf("me = %+v", me)
+	}
+}
+
+// me returns the user token belongs to.
+func (ts *testServer) me(token string) User {
+	ts.t.Helper()
+	var user User
+	ts.expect(ts.do("GET", "/auth/me", token, nil), http.StatusOK, &user)
+	return user
+}
+
+func TestRoleManagement(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+	viewer := ts.login("viewer")
+	adminID := strconv.Itoa(ts.me(admin).ID)
+	viewerID := strconv.Itoa(ts.me(viewer).ID)
+
+	ts.expect(ts.do("POST", "/admin/users/"+viewerID+"/roles", viewer, map[string]string{"role": roleAdmin}), http.StatusForbidden, nil)
+	ts.expect(ts.do("POST", "/admin/users/"+viewerID+"/roles", admin, map[string]string{"role": roleViewer}), http.StatusBadRequest, nil)
+	ts.expect(ts.do("POST", "/admin/users/999/roles", admin, map[string]string{"role": roleEditor}), http.StatusNotFound, nil)
+
+	var user User
+	ts.expect(ts.do("POST", "/admin/users/"+viewerID+"/roles", admin, map[string]string{"role": roleEditor}), http.StatusOK, &user)
+	if !reflect.DeepEqual(user.Roles, []string{roleEditor}) {
+		t.Errorf("roles = %q after the grant", user.Roles)
+	}
+	// The role applies to the user's existing session.
+	ts.expect(ts.do("POST", "/movies", viewer, testMovie("Alien", 1979)), http.StatusOK, nil)
+
+	ts.expect(ts.do("DELETE", "/admin/users/"+viewerID+"/roles/"+roleEditor, admin, nil), http.StatusOK, &user)
+	if len(user.Roles) != 0 {
+		t.Errorf("roles = %q after the revoke", user.Roles)
+	}
+	ts.expect(ts.do("POST", "/movies", viewer, testMovie("Aliens", 1986)), http.StatusForbidden, nil)
+
+	// The last admin keeps the role.
+	ts.expect(ts.do("DELETE", "/admin/users/"+adminID+"/roles/"+roleAdmin, admin, nil), http.StatusConflict, nil)
+	ts.expect(ts.do("POST", "/admin/users/"+viewerID+"/roles", admin, map[string]string{"role": roleAdmin}), http.StatusOK, nil)
+	ts.expect(ts.do("DELETE", "/admin/users/"+adminID+"/roles/"+roleAdmin, admin, nil), http.StatusOK, nil)
+	ts.expect(ts.do("GET", "/admin/users", admin, nil), http.StatusForbidden, nil)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SearchQuery is a parsed /movies/search request. The q parameter is a
+// list of clauses that must all hold, for example
+//
+//	director:nolan category:"sci-fi" -category:horror title:dark year:>2000 actor:caine tag:heist
+//
+// Bare words and quoted phrases search titles, categories, tags and the
+// people credited or cast; a leading "-" negates a clause.
+type SearchQuery struct {
+	Clauses []searchClause
+	// Similarity is the minimum trigram word similarity between the free
+	// text and a title or director name for a fuzzy match; zero disables
+	// fuzzy matching.
+	Similarity float64
+}
+
+// searchClause is a node of a parsed query: a *textClause, *fieldClause,
+// *categoryClause, *tagClause or *yearClause.
+type searchClause interface {
+	negated() bool
+}
+
+// clauseBase holds what every clause has: where it starts in the query, in
+// runes from zero, and whether it was negated.
+type clauseBase struct {
+	Pos     int
+	Negated bool
+}
+
+func (c clauseBase) negated() bool { return c.Negated }
+
+// textClause matches free text against titles, categories, tags and people.
+type textClause struct {
+	clauseBase
+	Term searchTerm
+}
+
+// fieldClause matches text against a single field: "title", "director"
+// (the primary director) or "actor" (any cast member).
+type fieldClause struct {
+	clauseBase
+	Field string
+	Term  searchTerm
+}
+
+// categoryClause matches a category name, case-insensitively. With Prefix
+// it matches names beginning with Name.
+type categoryClause struct {
+	clauseBase
+	Name   string
+	Prefix bool
+}
+
+// tagClause matches a tag name, case-insensitively. With Prefix it matches
+// names beginning with Name.
+type tagClause struct {
+	clauseBase
+	Name   string
+	Prefix bool
+}
+
+// yearClause compares the release year. Op is one of = < <= > >=, or ".."
+// for the inclusive range Year to To.
+type yearClause struct {
+	clauseBase
+	Op   string
+	Year int
+	To   int
+}
+
+// QueryError reports a malformed search query.
+type QueryError struct {
+	Pos   int    // offset of the offending token, in runes from zero
+	Token string // the offending token
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d (%q)", e.Msg, e.Pos, e.Token)
+}
+
+// textTerms returns the terms of the positive free-text clauses, which
+// drive ranking and fuzzy matching.
+func (q SearchQuery) textTerms() []searchTerm {
+	var terms []searchTerm
+	for _, c := range q.Clauses {
+		if c, ok := c.(*textClause); ok && !c.Negated {
+			terms = append(terms, c.Term)
+		}
+	}
+	return terms
+}
+
+// highlightTerms returns every positive term whose words may appear in a
+// snippet.
+func (q SearchQuery) highlightTerms() []searchTerm {
+	var terms []searchTerm
+	for _, c := range q.Clauses {
+		switch c := c.(type) {
+		case *textClause:
+			if !c.Negated {
+				terms = append(terms, c.Term)
+			}
+		case *fieldClause:
+			if !c.Negated {
+				terms = append(terms, c.Term)
+			}
+		}
+	}
+	return terms
+}
+
+// fuzzyText is the free text as compared by trigram similarity.
+func (q SearchQuery) fuzzyText() string {
+	var words []string
+	for _, t := range q.textTerms() {
+		words = append(words, t.Words...)
+	}
+	return strings.Join(words, " ")
+}
+
+// queryToken is a lexed clause: an optional "-", an optional field name and
+// a value that may have been quoted.
+type queryToken struct {
+	pos      int // start of the whole clause
+	negated  bool
+	field    string
+	value    string
+	valuePos int
+	quoted   bool
+	text     string // the clause as written
+}
+
+// queryFields are the field names a clause may start with. Any other
+// "word:" is free text, so titles like "Mission: Impossible" search as
+// written.
+var queryFields = map[string]bool{
+	"title": true, "director": true, "actor": true,
+	"category": true, "tag": true, "year": true,
+}
+
+// lexQuery splits q into clauses.
+func lexQuery(q string) ([]queryToken, error) {
+	runes := []rune(q)
+	var tokens []queryToken
+
+	i := 0
+	for {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			return tokens, nil
+		}
+
+		tok := queryToken{pos: i}
+		if runes[i] == '-' {
+			tok.negated = true
+			i++
+		}
+
+		// A field is a known field name followed by a colon.
+		j := i
+		for j < len(runes) && unicode.IsLetter(runes[j]) {
+			j++
+		}
+		if field := strings.ToLower(string(runes[i:j])); queryFields[field] && j < len(runes) && runes[j] == ':' {
+			tok.field = field
+			i = j + 1
+		}
+
+		tok.valuePos = i
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &QueryError{Pos: i, Token: string(runes[i:]), Msg: "unterminated quote"}
+			}
+			tok.value, tok.quoted = string(runes[i+1:end]), true
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			tok.value = string(runes[i:end])
+			i = end
+		}
+
+		tok.text = string(runes[tok.pos:i])
+		if tok.value == "" && !tok.quoted {
+			msg := "missing value"
+			if tok.field == "" {
+				msg = "dangling \"-\""
+			}
+			return nil, &QueryError{Pos: tok.pos, Token: tok.text, Msg: msg}
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// parseSearchQuery parses the q parameter of /movies/search.
+func parseSearchQuery(q string) (SearchQuery, error) {
+	var sq SearchQuery
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return sq, err
+	}
+
+	for _, tok := range tokens {
+		base := clauseBase{Pos: tok.pos, Negated: tok.negated}
+		switch tok.field {
+		case "":
+			term, ok := parseTerm(tok)
+			if !ok {
+				// Bare punctuation carries nothing to search for.
+				continue
+			}
+			sq.Clauses = append(sq.Clauses, &textClause{clauseBase: base, Term: term})
+		case "title", "director", "actor":
+			term, ok := parseTerm(tok)
+			if !ok {
+				return sq, &QueryError{Pos: tok.valuePos, Token: tok.text, Msg: "no searchable words"}
+			}
+			sq.Clauses = append(sq.Clauses, &fieldClause{clauseBase: base, Field: tok.field, Term: term})
+		case "category", "tag":
+			name := strings.TrimSpace(tok.value)
+			prefix := !tok.quoted && strings.HasSuffix(name, "*")
+			if prefix {
+				name = strings.TrimSuffix(name, "*")
+			}
+			if name == "" {
+				return sq, &QueryError{Pos: tok.valuePos, Token: tok.text, Msg: "missing " + tok.field + " name"}
+			}
+			if tok.field == "tag" {
+				sq.Clauses = append(sq.Clauses, &tagClause{clauseBase: base, Name: name, Prefix: prefix})
+			} else {
+				sq.Clauses = append(sq.Clauses, &categoryClause{clauseBase: base, Name: name, Prefix: prefix})
+			}
+		case "year":
+			c, err := parseYear(tok)
+			if err != nil {
+				return sq, err
+			}
+			c.clauseBase = base
+			sq.Clauses = append(sq.Clauses, c)
+		}
+	}
+
+	if len(sq.Clauses) == 0 {
+		return sq, &QueryError{Pos: 0, Token: q, Msg: "no searchable words"}
+	}
+	return sq, nil
+}
+
+// parseTerm turns a clause value into a term. Quoted values and values with
+// inner punctuation (e.g. "spider-man") become phrases, matching how
+// PostgreSQL tokenizes the indexed text; a trailing "*" on a bare value
+// makes its last word a prefix.
+func parseTerm(tok queryToken) (searchTerm, bool) {
+	words := splitWords(tok.value)
+	if len(words) == 0 {
+		return searchTerm{}, false
+	}
+	return searchTerm{Words: words, Prefix: !tok.quoted && strings.HasSuffix(tok.value, "*")}, true
+}
+
+// parseYear parses "2000", ">2000", ">=2000", "<2000", "<=2000" or
+// "1970..1979".
+func parseYear(tok queryToken) (*yearClause, error) {
+	bad := func(msg string) error {
+		return &QueryError{Pos: tok.valuePos, Token: tok.text, Msg: msg}
+	}
+	value := tok.value
+
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		y1, err1 := strconv.Atoi(from)
+		y2, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil {
+			return nil, bad("year range must look like 1970..1979")
+		}
+		if y1 > y2 {
+			return nil, bad("year range is reversed")
+		}
+		return &yearClause{Op: "..", Year: y1, To: y2}, nil
+	}
+
+	op := "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, candidate) {
+			op, value = candidate, strings.TrimPrefix(value, candidate)
+			break
+		}
+	}
+	year, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, bad("year must be a number, optionally preceded by <, <=, >, >= or =")
+	}
+	return &yearClause{Op: op, Year: year}, nil
+}
+
+// matchYear reports whether year satisfies c. An unknown (zero) year never
+// satisfies a comparison.
+func (c *yearClause) matchYear(year int) bool {
+	if year == 0 {
+		return false
+	}
+	switch c.Op {
+	case "..":
+		return year >= c.Year && year <= c.To
+	case "<":
+		return year < c.Year
+	case "<=":
+		return year <= c.Year
+	case ">":
+		return year > c.Year
+	case ">=":
+		return year >= c.Year
+	}
+	return year == c.Year
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	text := func(pos int, negated bool, prefix bool, words ...string) *textClause {
+		return &textClause{clauseBase{pos, negated}, searchTerm{Words: words, Prefix: prefix}}
+	}
+	tests := []struct {
+		q    string
+		want []searchClause
+	}{
+		{"alien", []searchClause{text(0, false, false, "alien")}},
+		{"Mission: Impossible", []searchClause{
+			text(0, false, false, "mission"),
+			text(9, false, false, "impossible"),
+		}},
+		{"Star Wars: Episode IV", []searchClause{
+			text(0, false, false, "star"),
+			text(5, false, false, "wars"),
+			text(11, false, false, "episode"),
+			text(19, false, false, "iv"),
+		}},
+		{"title:Mission: Impossible", []searchClause{
+			&fieldClause{clauseBase{0, false}, "title", searchTerm{Words: []string{"mission"}}},
+			text(15, false, false, "impossible"),
+		}},
+		{`"dark knight"`, []searchClause{text(0, false, false, "dark", "knight")}},
+		{`title:"Mission: Impossible"`, []searchClause{
+			&fieldClause{clauseBase{0, false}, "title", searchTerm{Words: []string{"mission", "impossible"}}},
+		}},
+		{"spider-man", []searchClause{text(0, false, false, "spider", "man")}},
+		{"termin*", []searchClause{text(0, false, true, "termin")}},
+		{"-horror", []searchClause{text(0, true, false, "horror")}},
+		{"Director:Nolan -category:horror", []searchClause{
+			&fieldClause{clauseBase{0, false}, "director", searchTerm{Words: []string{"nolan"}}},
+			&categoryClause{clauseBase{15, true}, "horror", false},
+		}},
+		{`category:"sci-fi" tag:heist*`, []searchClause{
+			&categoryClause{clauseBase{0, false}, "sci-fi", false},
+			&tagClause{clauseBase{18, false}, "heist", true},
+		}},
+		{"year:>=2000 year:1970..1979", []searchClause{
+			&yearClause{clauseBase{0, false}, ">=", 2000, 0},
+			&yearClause{clauseBase{12, false}, "..", 1970, 1979},
+		}},
+		{"alien : !", []searchClause{text(0, false, false, "alien")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			sq, err := parseSearchQuery(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sq.Clauses, tt.want) {
+				t.Errorf("clauses:\ngot  %#v\nwant %#v", sq.Clauses, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	tests := []struct {
+		q     string
+		pos   int
+		token string
+	}{
+		{"", 0, ""},
+		{"!!!", 0, "!!!"},
+		{`"unterminated`, 0, `"unterminated`},
+		{`alien title:"dark`, 12, `"dark`},
+		{"alien -", 6, "-"},
+		{"title:", 0, "title:"},
+		{"alien year:", 6, "year:"},
+		{"title:!!", 6, "title:!!"},
+		{"category:*", 9, "category:*"},
+		{"year:nineteen", 5, "year:nineteen"},
+		{"year:1980..1970", 5, "year:1980..1970"},
+		{"year:1970..", 5, "year:1970.."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			_, err := parseSearchQuery(tt.q)
+			var qerr *QueryError
+			if !errors.As(err, &qerr) {
+				t.Fatalf("err = %v, want a *QueryError", err)
+			}
+			if qerr.Pos != tt.pos || qerr.Token != tt.token {
+				t.Errorf("error at %d (%q), want %d (%q): %v", qerr.Pos, qerr.Token, tt.pos, tt.token, err)
+			}
+		})
+	}
+}
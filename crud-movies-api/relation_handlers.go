@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// addRelation relates movie {id} to the movie in the body, e.g. as its
+// sequel_of, and returns movie {id} with its relations.
+func (s *server) addRelation(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid movie id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Kind    string `json:"kind"`
+		MovieID int    `json:"movie_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, kind, to, err := storedRelation(id, body.Kind, body.MovieID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.AddRelation(r.Context(), from, kind, to)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error relating movie %d to %d: %v", id, body.MovieID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeMovie(w, r, id)
+}
+
+// removeRelation deletes the relation of movie {id} as {kind} of movie
+// {related}, and returns movie {id} with its remaining relations.
+func (s *server) removeRelation(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid movie id", http.StatusBadRequest)
+		return
+	}
+	related, err := strconv.Atoi(mux.Vars(r)["related"])
+	if err != nil {
+		http.Error(w, "Invalid related movie id", http.StatusBadRequest)
+		return
+	}
+	from, kind, to, err := storedRelation(id, mux.Vars(r)["kind"], related)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.RemoveRelation(r.Context(), from, kind, to)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Relation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error removing relation of movie %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeMovie(w, r, id)
+}
+
+// writeMovie responds with movie id as GET /movies/{id} would.
+func (s *server) writeMovie(w http.ResponseWriter, r *http.Request, id int) {
+	movie, err := s.store.GetMovie(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Movie not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching movie %d: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, movie)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MovieRef identifies a related movie without its details.
+type MovieRef struct {
+	ID    string `json:"id"`
+	MID   string `json:"mid"`
+	Title string `json:"title"`
+	Year  int    `json:"year,omitempty"`
+}
+
+// Relation reads "this movie is Kind of Movie", e.g. a sequel_of its
+// predecessor. Kind is one of relationKinds.
+type Relation struct {
+	Kind  string   `json:"kind"`
+	Movie MovieRef `json:"movie"`
+}
+
+// relationInverses maps each kind of relation to the kind stating it from
+// the other movie. Stores keep only storedRelationKinds.
+var relationInverses = map[string]string{
+	"sequel_of":   "prequel_of",
+	"prequel_of":  "sequel_of",
+	"remake_of":   "remade_as",
+	"remade_as":   "remake_of",
+	"spin_off_of": "spun_off_as",
+	"spun_off_as": "spin_off_of",
+}
+
+var storedRelationKinds = map[string]bool{"sequel_of": true, "remake_of": true, "spin_off_of": true}
+
+// relationKinds lists the kinds clients may use.
+func relationKinds() []string {
+	var kinds []string
+	for k := range relationInverses {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// storedRelation returns "id is kind of relatedID" in the form stores keep
+// it, swapping the movies for an inverse kind.
+func storedRelation(id int, kind string, relatedID int) (int, string, int, error) {
+	inverse, ok := relationInverses[kind]
+	if !ok {
+		return 0, "", 0, fmt.Errorf("unknown relation kind %q, expected one of %v", kind, relationKinds())
+	}
+	if id == relatedID {
+		return 0, "", 0, fmt.Errorf("a movie cannot be related to itself")
+	}
+	if storedRelationKinds[kind] {
+		return id, kind, relatedID, nil
+	}
+	return relatedID, inverse, id, nil
+}
+
+// sortRelations orders relations by kind, then by the related movies'
+// years and titles.
+func sortRelations(relations []Relation) {
+	sort.Slice(relations, func(i, j int) bool {
+		a, b := relations[i], relations[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Movie.Year != b.Movie.Year {
+			return a.Movie.Year < b.Movie.Year
+		}
+		return a.Movie.Title < b.Movie.Title
+	})
+}
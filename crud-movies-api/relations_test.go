@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestStoredRelation(t *testing.T) {
+	tests := []struct {
+		id      int
+		kind    string
+		related int
+		want    [3]interface{}
+		ok      bool
+	}{
+		{1, "sequel_of", 2, [3]interface{}{1, "sequel_of", 2}, true},
+		{1, "prequel_of", 2, [3]interface{}{2, "sequel_of", 1}, true},
+		{1, "remade_as", 2, [3]interface{}{2, "remake_of", 1}, true},
+		{1, "spin_off_of", 2, [3]interface{}{1, "spin_off_of", 2}, true},
+		{1, "sequel_of", 1, [3]interface{}{}, false},
+		{1, "cousin_of", 2, [3]interface{}{}, false},
+	}
+	for _, tt := range tests {
+		from, kind, to, err := storedRelation(tt.id, tt.kind, tt.related)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("storedRelation(%d, %q, %d): want an error", tt.id, tt.kind, tt.related)
+			}
+			continue
+		}
+		if got := [3]interface{}{from, kind, to}; err != nil || got != tt.want {
+			t.Errorf("storedRelation(%d, %q, %d) = %v, %v; want %v", tt.id, tt.kind, tt.related, got, err, tt.want)
+		}
+	}
+}
+
+// relate makes movie id kind of movie related through the API and
+// returns the response.
+func (ts *testServer) relate(token, id, kind, related string) *http.Response {
+	ts.t.Helper()
+	relatedID, err := strconv.Atoi(related)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	body := map[string]interface{}{"kind": kind, "movie_id": relatedID}
+	return ts.do("POST", "/movies/"+id+"/relations", token, body).Result()
+}
+
+func TestSequelCycles(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	first := ts.createMovie(admin, testMovie("Alien", 1979)).ID
+	second := ts.createMovie(admin, testMovie("Aliens", 1986)).ID
+	third := ts.createMovie(admin, testMovie("Alien 3", 1992)).ID
+	fourth := ts.createMovie(admin, testMovie("Alien Resurrection", 1997)).ID
+
+	for _, step := range []struct {
+		id, kind, related string
+		status            int
+	}{
+		{second, "sequel_of", first, http.StatusOK},
+		{second, "prequel_of", third, http.StatusOK},
+		{fourth, "sequel_of", third, http.StatusOK},
+		// Adding the same relation again changes nothing.
+		{third, "sequel_of", second, http.StatusOK},
+
+		{first, "sequel_of", second, http.StatusConflict},
+		{first, "sequel_of", fourth, http.StatusConflict},
+		{fourth, "prequel_of", first, http.StatusConflict},
+		{third, "prequel_of", second, http.StatusConflict},
+		{first, "sequel_of", first, http.StatusBadRequest},
+
+		// Other kinds may point either way.
+		{first, "remake_of", fourth, http.StatusOK},
+		{fourth, "remake_of", first, http.StatusOK},
+		{first, "sequel_of", "999", http.StatusNotFound},
+	} {
+		if got := ts.relate(admin, step.id, step.kind, step.related).StatusCode; got != step.status {
+			t.Errorf("%s %s %s: status = %d, want %d", step.id, step.kind, step.related, got, step.status)
+		}
+	}
+
+	var movie Movie
+	ts.expect(ts.do("GET", "/movies/"+second, "", nil), http.StatusOK, &movie)
+	want := []Relation{
+		{Kind: "prequel_of", Movie: MovieRef{ID: third, Title: "Alien 3", Year: 1992}},
+		{Kind: "sequel_of", Movie: MovieRef{ID: first, Title: "Alien", Year: 1979}},
+	}
+	if len(movie.Relations) != len(want) {
+		t.Fatalf("relations = %+v, want %+v", movie.Relations, want)
+	}
+	for i, r := range movie.Relations {
+		if r.Kind != want[i].Kind || r.Movie.ID != want[i].Movie.ID || r.Movie.Title != want[i].Movie.Title {
+			t.Errorf("relation %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+
+	// Once the chain is broken, the former cycle is allowed.
+	ts.expect(ts.do("DELETE", "/movies/"+third+"/relations/prequel_of/"+fourth, admin, nil), http.StatusOK, nil)
+	ts.expect(ts.do("DELETE", "/movies/"+third+"/relations/prequel_of/"+fourth, admin, nil), http.StatusNotFound, nil)
+	if got := ts.relate(admin, first, "sequel_of", fourth).StatusCode; got != http.StatusOK {
+		t.Errorf("status = %d after the chain was broken, want %d", got, http.StatusOK)
+	}
+
+	editor := ts.login("editor", roleEditor)
+	if got := ts.relate(editor, third, "spin_off_of", first).StatusCode; got != http.StatusOK {
+		t.Errorf("editor relating movies: status = %d", got)
+	}
+	if got := ts.relate("", third, "spin_off_of", first).StatusCode; got != http.StatusUnauthorized {
+		t.Errorf("anonymous relating movies: status = %d", got)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchTerm is one required part of a search query: a single word, or the
+// words of a quoted phrase that must appear next to each other. A trailing
+// "*" makes the last word match as a prefix.
+type searchTerm struct {
+	Words  []string
+	Prefix bool
+}
+
+// tsquery renders the term in to_tsquery syntax. Words contain only letters
+// and digits, so no escaping is needed.
+func (t searchTerm) tsquery() string {
+	q := strings.Join(t.Words, " <-> ")
+	if t.Prefix {
+		q += ":*"
+	}
+	return q
+}
+
+// anyTermTSQuery ORs every term together; it drives snippet highlighting.
+func anyTermTSQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = "(" + t.tsquery() + ")"
+	}
+	return strings.Join(parts, " | ")
+}
+
+// allTermsTSQuery ANDs every term together; it drives ranking.
+func allTermsTSQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = "(" + t.tsquery() + ")"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// matchWords reports where the term occurs in words, returning the index of
+// its first word or -1. It is the in-memory counterpart of tsquery matching,
+// without stemming.
+func (t searchTerm) matchWords(words []string) int {
+	for i := 0; i+len(t.Words) <= len(words); i++ {
+		ok := true
+		for j, w := range t.Words {
+			last := j == len(t.Words)-1
+			if words[i+j] != w && !(last && t.Prefix && strings.HasPrefix(words[i+j], w)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitWords lowercases s and splits it into words of letters and digits.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !isWordRune(r) })
+}
+
+// highlightTerms wraps every word of text matched by a term in <mark> tags,
+// like ts_headline with HighlightAll.
+func highlightTerms(text string, terms []searchTerm) string {
+	var b strings.Builder
+	for text != "" {
+		start := strings.IndexFunc(text, isWordRune)
+		if start < 0 {
+			b.WriteString(text)
+			break
+		}
+		b.WriteString(text[:start])
+		text = text[start:]
+		end := strings.IndexFunc(text, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(text)
+		}
+
+		word := text[:end]
+		if termsMention(terms, strings.ToLower(word)) {
+			b.WriteString("<mark>" + word + "</mark>")
+		} else {
+			b.WriteString(word)
+		}
+		text = text[end:]
+	}
+	return b.String()
+}
+
+// termsMention reports whether word is one of the words of any term.
+func termsMention(terms []searchTerm, word string) bool {
+	for _, t := range terms {
+		for i, w := range t.Words {
+			if w == word || (t.Prefix && i == len(t.Words)-1 && strings.HasPrefix(word, w)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// trigrams returns the pg_trgm trigrams of s: each word is lowercased and
+// padded with two leading spaces and one trailing space.
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range splitWords(s) {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// wordSimilarity approximates pg_trgm's word_similarity(q, text): the share
+// of q's trigrams that also occur in text.
+func wordSimilarity(q, text string) float64 {
+	qt := trigrams(q)
+	if len(qt) == 0 {
+		return 0
+	}
+	tt := trigrams(text)
+	shared := 0
+	for t := range qt {
+		if tt[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(qt))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Default trigram similarity thresholds. Suggestions use a looser one
+// because they are only offered once fuzzy matching has found nothing.
+const (
+	defaultSearchSimilarity  = 0.45
+	defaultSuggestSimilarity = 0.3
+	maxSuggestions           = 5
+)
+
+// server holds the dependencies shared by the HTTP handlers.
+type server struct {
+	store Store
+
+	searchSimilarity  float64
+	suggestSimilarity float64
+	// autoCleanupCategories deletes the categories left without movies after
+	// every movie update or delete; otherwise that takes POST
+	// /categories/cleanup.
+	autoCleanupCategories bool
+	// sessionTTL is how long a login lasts.
+	sessionTTL time.Duration
+	// oidc is nil unless login through an OpenID Connect provider is
+	// configured.
+	oidc *oidcAuth
+}
+
+func newServer(store Store) *server {
+	return &server{
+		store:             store,
+		searchSimilarity:  defaultSearchSimilarity,
+		suggestSimilarity: defaultSuggestSimilarity,
+		sessionTTL:        defaultSessionTTL,
+	}
+}
+
+// routes builds the router for every API endpoint. Who may use each is
+// up to routePolicy.
+func (s *server) routes() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(s.authenticate, s.authorize)
+
+	r.HandleFunc("/health", s.healthCheck).Methods("GET")
+	r.HandleFunc("/auth/register", s.register).Methods("POST")
+	r.HandleFunc("/auth/login", s.login).Methods("POST")
+	r.HandleFunc("/auth/logout", s.logout).Methods("POST")
+	r.HandleFunc("/auth/me", s.me).Methods("GET")
+	if s.oidc != nil {
+		r.HandleFunc("/auth/oidc/login", s.oidcLogin).Methods("GET")
+		r.HandleFunc("/auth/oidc/callback", s.oidcCallback).Methods("GET")
+	}
+	r.HandleFunc("/admin/users", s.getUsers).Methods("GET")
+	r.HandleFunc("/admin/users/{id}/roles", s.grantRole).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/roles/{role}", s.revokeRole).Methods("DELETE")
+	r.HandleFunc("/admin/api-keys", s.getAPIKeys).Methods("GET")
+	r.HandleFunc("/admin/api-keys", s.createAPIKey).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{id}", s.deleteAPIKey).Methods("DELETE")
+	r.HandleFunc("/autocomplete", s.autocomplete).Methods("GET")
+	r.HandleFunc("/movies/search", s.searchMovies).Methods("GET") // Must precede /movies/{id}
+	r.HandleFunc("/movies", s.getMovies).Methods("GET")
+	r.HandleFunc("/movies", s.createMovie).Methods("POST")
+	r.HandleFunc("/movies/by-mid/{mid}", s.getMovieByMID).Methods("GET")
+	r.HandleFunc("/movies/{id}", s.getMovie).Methods("GET")
+	r.HandleFunc("/movies/{id}", s.updateMovie).Methods("PUT")
+	r.HandleFunc("/movies/{id}", s.deleteMovie).Methods("DELETE")
+	r.HandleFunc("/movies/{id}/relations", s.addRelation).Methods("POST")
+	r.HandleFunc("/movies/{id}/relations/{kind}/{related}", s.removeRelation).Methods("DELETE")
+	r.HandleFunc("/directors", s.getDirectors).Methods("GET")
+	r.HandleFunc("/directors", s.createDirector).Methods("POST")
+	r.HandleFunc("/directors/{id}", s.getDirector).Methods("GET")
+	r.HandleFunc("/directors/{id}", s.updateDirector).Methods("PUT")
+	r.HandleFunc("/directors/{id}", s.deleteDirector).Methods("DELETE")
+	r.HandleFunc("/directors/{id}/movies", s.getMoviesByDirector).Methods("GET")
+	r.HandleFunc("/directors/{id}/merge-into/{target}", s.mergeDirector).Methods("POST")
+	r.HandleFunc("/people/{id}/movies", s.getMoviesByPerson).Methods("GET")
+	r.HandleFunc("/categories", s.getCategories).Methods("GET")
+	r.HandleFunc("/categories", s.createCategory).Methods("POST")
+	r.HandleFunc("/categories/cleanup", s.cleanupCategories).Methods("POST")
+	r.HandleFunc("/categories/{id}", s.updateCategory).Methods("PUT")
+	r.HandleFunc("/categories/{id}", s.deleteCategory).Methods("DELETE")
+	r.HandleFunc("/categories/{id}/move", s.moveCategory).Methods("POST")
+	r.HandleFunc("/categories/{id}/merge-into/{target}", s.mergeCategory).Methods("POST")
+	r.HandleFunc("/categories/{id}/movies", s.getMoviesByCategory).Methods("GET")
+	r.HandleFunc("/tags", s.getTags).Methods("GET")
+	r.HandleFunc("/tags/{id}", s.renameTag).Methods("PUT")
+	r.HandleFunc("/tags/{id}", s.deleteTag).Methods("DELETE")
+	r.HandleFunc("/tags/{id}/merge-into/{target}", s.mergeTag).Methods("POST")
+	r.HandleFunc("/collections", s.getCollections).Methods("GET")
+	r.HandleFunc("/collections", s.createCollection).Methods("POST")
+	r.HandleFunc("/collections/{id}", s.getCollection).Methods("GET")
+	r.HandleFunc("/collections/{id}", s.updateCollection).Methods("PUT")
+	r.HandleFunc("/collections/{id}", s.deleteCollection).Methods("DELETE")
+
+	return r
+}
+
+func (s *server) healthCheck(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.Ping(r.Context()); err != nil {
+		http.Error(w, "Database connection failed", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+}
+
+// writeJSON encodes v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// idParam parses the {id} route variable.
+func idParam(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testServer runs the API's handlers against a fresh store.
+type testServer struct {
+	t       *testing.T
+	srv     *server
+	store   Store
+	handler http.Handler
+}
+
+// newTestServer returns a testServer on a memoryStore.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWith(t, newMemoryStore())
+}
+
+func newTestServerWith(t *testing.T, store Store) *testServer {
+	srv := newServer(store)
+	return &testServer{t: t, srv: srv, store: store, handler: srv.routes()}
+}
+
+// eachStore runs test against a memoryStore and, when TEST_POSTGRES names
+// a database, against a postgresStore, to check that the backends agree.
+func eachStore(t *testing.T, test func(t *testing.T, ts *testServer)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newTestServer(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, newTestServerWith(t, newTestPostgres(t)))
+	})
+}
+
+// newTestPostgres returns a postgresStore on a freshly migrated newTestDB.
+func newTestPostgres(t *testing.T) *postgresStore {
+	t.Helper()
+	db := newTestDB(t)
+	m, err := newMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return &postgresStore{db: db}
+}
+
+// newTestDB connects to a new, empty schema of the database TEST_POSTGRES,
+// a connection string like postgresConnStr builds, and drops the schema
+// when the test ends. The test is skipped if TEST_POSTGRES is unset.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	connStr := os.Getenv("TEST_POSTGRES")
+	if connStr == "" {
+		t.Skip("TEST_POSTGRES is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// Extensions stay in public, which is searched after the schema.
+	db, err := sql.Open("postgres", connStr+" search_path="+schema+",public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// login creates a user holding roles and returns a session token for them.
+func (ts *testServer) login(username string, roles ...string) string {
+	ts.t.Helper()
+	ctx := context.Background()
+	user := User{Username: username}
+	if err := ts.store.CreateUser(ctx, &user, "unused"); err != nil {
+		ts.t.Fatal(err)
+	}
+	for _, role := range roles {
+		if _, err := ts.store.GrantRole(ctx, user.ID, role); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	token, hash, err := newToken()
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if err := ts.store.CreateSession(ctx, user.ID, hash, time.Now().Add(time.Hour)); err != nil {
+		ts.t.Fatal(err)
+	}
+	return token
+}
+
+// do sends a request, encoding body as JSON unless it is nil, with token
+// as its bearer token unless it is empty.
+func (ts *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect fails the test unless rec has the status, and decodes its body
+// into v if v is not nil.
+func (ts *testServer) expect(rec *httptest.ResponseRecorder, status int, v interface{}) {
+	ts.t.Helper()
+	if rec.Code != status {
+		ts.t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, strings.TrimSpace(rec.Body.String()))
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			ts.t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+	}
+}
+
+func testMovie(title string, year int) Movie {
+	return Movie{Title: title, Year: year, Director: Director{Firstname: "Ridley", Lastname: "Scott"}}
+}
+
+// createMovie stores a movie through the API and returns it.
+func (ts *testServer) createMovie(token string, movie Movie) Movie {
+	ts.t.Helper()
+	var created Movie
+	ts.expect(ts.do("POST", "/movies", token, movie), http.StatusOK, &created)
+	return created
+}
+
+func TestMovieCRUD(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	movie := testMovie("Alien", 1979)
+	movie.Categories = []Category{{Name: "Horror"}}
+	created := ts.createMovie(admin, movie)
+	if created.ID == "" || created.MID == "" {
+		t.Fatalf("created movie lacks an id or MID: %+v", created)
+	}
+	if created.Cover != defaultCoverURL {
+		t.Errorf("cover = %q, want the default", created.Cover)
+	}
+
+	var got Movie
+	ts.expect(ts.do("GET", "/movies/"+created.ID, "", nil), http.StatusOK, &got)
+	if got.Title != "Alien" || got.Director.Lastname != "Scott" || len(got.Categories) != 1 {
+		t.Errorf("GET returned %+v", got)
+	}
+
+	var byMID Movie
+	ts.expect(ts.do("GET", "/movies/by-mid/"+created.MID, "", nil), http.StatusOK, &byMID)
+	if byMID.ID != created.ID {
+		t.Errorf("by-mid returned movie %s, want %s", byMID.ID, created.ID)
+	}
+
+	update := testMovie("Alien: Director's Cut", 1979)
+	var updated Movie
+	ts.expect(ts.do("PUT", "/movies/"+created.ID, admin, update), http.StatusOK, &updated)
+	if updated.Title != update.Title || updated.MID != created.MID {
+		t.Errorf("update returned %+v; the MID must not change", updated)
+	}
+
+	var list []Movie
+	ts.expect(ts.do("GET", "/movies", "", nil), http.StatusOK, &list)
+	if len(list) != 1 || list[0].Title != update.Title {
+		t.Errorf("list = %+v", list)
+	}
+
+	ts.expect(ts.do("DELETE", "/movies/"+created.ID, admin, nil), http.StatusOK, nil)
+	ts.expect(ts.do("GET", "/movies/"+created.ID, "", nil), http.StatusNotFound, nil)
+	ts.expect(ts.do("DELETE", "/movies/"+created.ID, admin, nil), http.StatusNotFound, nil)
+}
+
+func TestUpdateMovieDirector(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+		alien := ts.createMovie(admin, testMovie("Alien", 1979))
+		bladeRunner := ts.createMovie(admin, testMovie("Blade Runner", 1982))
+		scott := alien.Director.ID
+		if bladeRunner.Director.ID != scott {
+			t.Fatalf("directors %d and %d, want one shared director", scott, bladeRunner.Director.ID)
+		}
+
+		// Naming another director changes only the movie updated.
+		update := testMovie("Alien", 1979)
+		update.Director = Director{Firstname: "Dan", Lastname: "O'Bannon"}
+		var updated Movie
+		ts.expect(ts.do("PUT", "/movies/"+alien.ID, admin, update), http.StatusOK, &updated)
+		if updated.Director.ID == scott || updated.Director.Lastname != "O'Bannon" {
+			t.Errorf("updated director = %+v", updated.Director)
+		}
+		var other Movie
+		ts.expect(ts.do("GET", "/movies/"+bladeRunner.ID, "", nil), http.StatusOK, &other)
+		if other.Director.ID != scott || other.Director.Firstname != "Ridley" || other.Director.Lastname != "Scott" {
+			t.Errorf("Blade Runner's director = %+v, want Ridley Scott unchanged", other.Director)
+		}
+
+		// The previous director goes once no movie credits them.
+		update = testMovie("Blade Runner", 1982)
+		update.Director = Director{Firstname: "Hampton", Lastname: "Fancher"}
+		ts.expect(ts.do("PUT", "/movies/"+bladeRunner.ID, admin, update), http.StatusOK, nil)
+		ts.expect(ts.do("GET", "/directors/"+strconv.Itoa(scott), "", nil), http.StatusNotFound, nil)
+	})
+}
+
+func TestRenameDirector(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+		alien := ts.createMovie(admin, testMovie("Alien", 1979))
+		bladeRunner := ts.createMovie(admin, testMovie("Blade Runner", 1982))
+		scott := alien.Director.ID
+
+		// Renaming the director itself renames it on every movie.
+		rename := Director{Firstname: "Sir Ridley", Lastname: "Scott"}
+		ts.expect(ts.do("PUT", "/directors/"+strconv.Itoa(scott), admin, rename), http.StatusOK, nil)
+		for _, id := range []string{alien.ID, bladeRunner.ID} {
+			var movie Movie
+			ts.expect(ts.do("GET", "/movies/"+id, "", nil), http.StatusOK, &movie)
+			if movie.Director.ID != scott || movie.Director.Firstname != "Sir Ridley" {
+				t.Errorf("movie %s's director = %+v", id, movie.Director)
+			}
+		}
+	})
+}
+
+func TestMovieValidation(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	tests := []struct {
+		name string
+		body interface{}
+	}{
+		{"no title", testMovie("", 1979)},
+		{"no director", Movie{Title: "Alien"}},
+		{"not JSON", "{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.expect(ts.do("POST", "/movies", admin, tt.body), http.StatusBadRequest, nil)
+		})
+	}
+	ts.expect(ts.do("GET", "/movies/abc", "", nil), http.StatusBadRequest, nil)
+	ts.expect(ts.do("PUT", "/movies/999", admin, testMovie("Alien", 1979)), http.StatusNotFound, nil)
+}
+
+func TestCategoryHandlers(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	var sciFi Category
+	ts.expect(ts.do("POST", "/categories", admin, Category{Name: "Sci-Fi"}), http.StatusCreated, &sciFi)
+	ts.expect(ts.do("POST", "/categories", admin, Category{Name: "Sci-Fi"}), http.StatusConflict, nil)
+	ts.expect(ts.do("POST", "/categories", admin, Category{Name: " "}), http.StatusBadRequest, nil)
+
+	movie := testMovie("Alien", 1979)
+	movie.Categories = []Category{{Name: "Sci-Fi"}}
+	ts.createMovie(admin, movie)
+
+	var movies []Movie
+	ts.expect(ts.do("GET", "/categories/"+strconv.Itoa(sciFi.ID)+"/movies", "", nil), http.StatusOK, &movies)
+	if len(movies) != 1 {
+		t.Errorf("category has %d movies, want 1", len(movies))
+	}
+
+	var flat []Category
+	ts.expect(ts.do("GET", "/categories?flat=true", "", nil), http.StatusOK, &flat)
+	if len(flat) != 1 || flat[0].MovieCount == nil || *flat[0].MovieCount != 1 {
+		t.Errorf("categories = %+v", flat)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CategoryRules define a smart category, whose movies are those passing
+// every rule that is set rather than those assigned to it. Categories and
+// ExcludeCategories name regular categories, each standing for itself
+// and its subcategories.
+type CategoryRules struct {
+	DirectorID        int    `json:"director_id,omitempty"`
+	PersonID          int    `json:"person_id,omitempty"`
+	YearFrom          int    `json:"year_from,omitempty"`
+	YearTo            int    `json:"year_to,omitempty"`
+	RuntimeMin        int    `json:"runtime_min,omitempty"`
+	RuntimeMax        int    `json:"runtime_max,omitempty"`
+	Language          string `json:"language,omitempty"`
+	Country           string `json:"country,omitempty"`
+	ContentRating     string `json:"content_rating,omitempty"`
+	Categories        []int  `json:"categories,omitempty"`         // in every one of these
+	ExcludeCategories []int  `json:"exclude_categories,omitempty"` // in none of these
+}
+
+// filters returns the rules that GET /movies also filters on.
+func (r CategoryRules) filters() ListOptions {
+	return ListOptions{
+		DirectorID:    r.DirectorID,
+		PersonID:      r.PersonID,
+		YearFrom:      r.YearFrom,
+		YearTo:        r.YearTo,
+		RuntimeMin:    r.RuntimeMin,
+		RuntimeMax:    r.RuntimeMax,
+		Language:      r.Language,
+		Country:       r.Country,
+		ContentRating: r.ContentRating,
+	}
+}
+
+// empty reports whether no rule is set.
+func (r CategoryRules) empty() bool {
+	return r.DirectorID == 0 && r.PersonID == 0 && r.YearFrom == 0 && r.YearTo == 0 &&
+		r.RuntimeMin == 0 && r.RuntimeMax == 0 && r.Language == "" && r.Country == "" &&
+		r.ContentRating == "" && len(r.Categories) == 0 && len(r.ExcludeCategories) == 0
+}
+
+// namesCategory reports whether the rules require or exclude category id.
+func (r CategoryRules) namesCategory(id int) bool {
+	for _, c := range append(append([]int{}, r.Categories...), r.ExcludeCategories...) {
+		if c == id {
+			return true
+		}
+	}
+	return false
+}
+
+// namesPerson reports whether the rules select the movies of person id.
+func (r CategoryRules) namesPerson(id int) bool {
+	return r.DirectorID == id || r.PersonID == id
+}
+
+// replacePerson returns the rules naming person intoID wherever they named
+// person id.
+func (r CategoryRules) replacePerson(id, intoID int) CategoryRules {
+	if r.DirectorID == id {
+		r.DirectorID = intoID
+	}
+	if r.PersonID == id {
+		r.PersonID = intoID
+	}
+	return r
+}
+
+// replaceCategory returns the rules naming category intoID wherever they
+// named category id, each category still named once.
+func (r CategoryRules) replaceCategory(id, intoID int) CategoryRules {
+	replace := func(ids []int) []int {
+		var replaced []int
+		seen := make(map[int]bool)
+		for _, c := range ids {
+			if c == id {
+				c = intoID
+			}
+			if !seen[c] {
+				seen[c] = true
+				replaced = append(replaced, c)
+			}
+		}
+		return replaced
+	}
+	r.Categories = replace(r.Categories)
+	r.ExcludeCategories = replace(r.ExcludeCategories)
+	return r
+}
+
+// contradiction returns a category the rules both require and exclude,
+// or 0.
+func (r CategoryRules) contradiction() int {
+	included := make(map[int]bool)
+	for _, id := range r.Categories {
+		included[id] = true
+	}
+	for _, id := range r.ExcludeCategories {
+		if included[id] {
+			return id
+		}
+	}
+	return 0
+}
+
+// Value stores rules as JSON.
+func (r CategoryRules) Value() (driver.Value, error) {
+	b, err := json.Marshal(r)
+	return string(b), err
+}
+
+// Scan reads rules stored by Value.
+func (r *CategoryRules) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, r)
+	case string:
+		return json.Unmarshal([]byte(src), r)
+	default:
+		return fmt.Errorf("cannot scan %T into CategoryRules", src)
+	}
+}
+
+// smartCategoryConflict is the ErrConflict of using smart category id as
+// a regular one.
+func smartCategoryConflict(id int, what string) error {
+	return fmt.Errorf("%w: category %d is a smart category, which %s", ErrConflict, id, what)
+}
+
+// mergedRules returns the rules of smart category smartID once category id
+// is merged into intoID, failing with ErrConflict if they would then both
+// require and exclude intoID.
+func mergedRules(smartID int, r CategoryRules, id, intoID int) (CategoryRules, error) {
+	r = r.replaceCategory(id, intoID)
+	if r.contradiction() != 0 {
+		return r, fmt.Errorf("%w: smart category %d would both require and exclude category %d", ErrConflict, smartID, intoID)
+	}
+	return r, nil
+}
+
+// validateRules checks that rules select something sensible and
+// normalizes their codes. Whether the people and categories they name
+// exist is left to the caller.
+func validateRules(r *CategoryRules) error {
+	r.Language = strings.ToLower(strings.TrimSpace(r.Language))
+	r.Country = strings.ToUpper(strings.TrimSpace(r.Country))
+	r.ContentRating = strings.ToUpper(strings.TrimSpace(r.ContentRating))
+
+	if r.empty() {
+		return fmt.Errorf("rules must set at least one rule")
+	}
+	if r.DirectorID < 0 || r.PersonID < 0 {
+		return fmt.Errorf("rules must name people by id")
+	}
+	if r.YearFrom < 0 || r.YearTo < 0 || r.YearTo != 0 && r.YearFrom > r.YearTo {
+		return fmt.Errorf("year_from and year_to must be an ascending range of years")
+	}
+	if r.RuntimeMin < 0 || r.RuntimeMax < 0 || r.RuntimeMax != 0 && r.RuntimeMin > r.RuntimeMax {
+		return fmt.Errorf("runtime_min and runtime_max must be an ascending range of minutes")
+	}
+	if r.Language != "" && !isCode(r.Language, 2) {
+		return fmt.Errorf("language must be a two-letter ISO 639-1 code")
+	}
+	if r.Country != "" && !isCode(r.Country, 2) {
+		return fmt.Errorf("country must be a two-letter ISO 3166-1 code")
+	}
+	if r.ContentRating != "" {
+		known := false
+		for _, rating := range contentRatings {
+			known = known || rating == r.ContentRating
+		}
+		if !known {
+			return fmt.Errorf("content_rating must be one of %s", strings.Join(contentRatings, ", "))
+		}
+	}
+	if id := r.contradiction(); id != 0 {
+		return fmt.Errorf("category %d cannot be both required and excluded", id)
+	}
+	return nil
+}
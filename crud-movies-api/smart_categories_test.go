@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules CategoryRules
+		ok    bool
+	}{
+		{"year range", CategoryRules{YearFrom: 1980, YearTo: 1989}, true},
+		{"open year range", CategoryRules{YearFrom: 2000}, true},
+		{"codes", CategoryRules{Language: " FR ", Country: "fr", ContentRating: "pg-13"}, true},
+		{"categories", CategoryRules{Categories: []int{1, 2}, ExcludeCategories: []int{3}}, true},
+		{"no rules", CategoryRules{}, false},
+		{"negative person", CategoryRules{DirectorID: -1}, false},
+		{"reversed years", CategoryRules{YearFrom: 1990, YearTo: 1980}, false},
+		{"negative runtime", CategoryRules{RuntimeMin: -5}, false},
+		{"reversed runtime", CategoryRules{RuntimeMin: 120, RuntimeMax: 90}, false},
+		{"long language", CategoryRules{Language: "fra"}, false},
+		{"numeric country", CategoryRules{Country: "12"}, false},
+		{"unknown rating", CategoryRules{ContentRating: "X"}, false},
+		{"included and excluded", CategoryRules{Categories: []int{1}, ExcludeCategories: []int{1}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRules(&tt.rules)
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+
+	r := CategoryRules{Language: " FR ", Country: "fr", ContentRating: "pg-13"}
+	if err := validateRules(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Language != "fr" || r.Country != "FR" || r.ContentRating != "PG-13" {
+		t.Errorf("codes not normalized: %+v", r)
+	}
+}
+
+// smartMovieTitles returns the sorted titles of smart category id.
+func (ts *testServer) smartMovieTitles(id int) []string {
+	ts.t.Helper()
+	var movies []Movie
+	ts.expect(ts.do("GET", categoryPath(id, "/movies"), "", nil), http.StatusOK, &movies)
+	titles := []string{}
+	for _, m := range movies {
+		titles = append(titles, m.Title)
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func TestSmartCategoryMovies(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	drama := ts.createCategory(admin, Category{Name: "Drama"})
+	ts.createCategory(admin, Category{Name: "War", ParentID: &drama.ID})
+	ts.createCategory(admin, Category{Name: "Comedy"})
+
+	for _, m := range []struct {
+		title      string
+		year       int
+		runtime    int
+		categories []string
+	}{
+		{"Apocalypse Now", 1979, 147, []string{"War"}},
+		{"Platoon", 1986, 120, []string{"War"}},
+		{"Ordinary People", 1980, 124, []string{"Drama"}},
+		{"M*A*S*H", 1970, 116, []string{"War", "Comedy"}},
+		{"Airplane!", 1980, 88, []string{"Comedy"}},
+	} {
+		movie := testMovie(m.title, m.year)
+		movie.Runtime = m.runtime
+		for _, name := range m.categories {
+			movie.Categories = append(movie.Categories, Category{Name: name})
+		}
+		ts.createMovie(admin, movie)
+	}
+
+	comedy := 0
+	var flat []Category
+	ts.expect(ts.do("GET", "/categories?flat=true&include_empty=true", "", nil), http.StatusOK, &flat)
+	for _, c := range flat {
+		if c.Name == "Comedy" {
+			comedy = c.ID
+		}
+	}
+
+	tests := []struct {
+		name  string
+		rules CategoryRules
+		want  []string
+	}{
+		{"years", CategoryRules{YearFrom: 1980, YearTo: 1989}, []string{"Airplane!", "Ordinary People", "Platoon"}},
+		{"category subtree", CategoryRules{Categories: []int{drama.ID}}, []string{"Apocalypse Now", "M*A*S*H", "Ordinary People", "Platoon"}},
+		{"excluded category", CategoryRules{Categories: []int{drama.ID}, ExcludeCategories: []int{comedy}}, []string{"Apocalypse Now", "Ordinary People", "Platoon"}},
+		{"runtime and year", CategoryRules{RuntimeMin: 120, YearTo: 1980}, []string{"Apocalypse Now", "Ordinary People"}},
+		{"nothing", CategoryRules{YearFrom: 2020}, []string{}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := tt.rules
+			smart := ts.createCategory(admin, Category{Name: "Smart " + strconv.Itoa(i), Rules: &rules})
+			got := ts.smartMovieTitles(smart.ID)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("movies = %q, want %q", got, tt.want)
+			}
+			if count := ts.category(smart.ID).MovieCount; count == nil || *count != len(tt.want) {
+				t.Errorf("movie_count = %v, want %d", count, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSmartCategoryValidation(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("admin", roleAdmin)
+
+	regular := ts.createCategory(admin, Category{Name: "Drama"})
+	smart := ts.createCategory(admin, Category{Name: "Eighties", Rules: &CategoryRules{YearFrom: 1980, YearTo: 1989}})
+
+	bad := []struct {
+		name     string
+		category Category
+	}{
+		{"parent", Category{Name: "Nineties", ParentID: &regular.ID, Rules: &CategoryRules{YearFrom: 1990}}},
+		{"invalid rules", Category{Name: "Nineties", Rules: &CategoryRules{YearFrom: 1999, YearTo: 1990}}},
+		{"unknown category", Category{Name: "Nineties", Rules: &CategoryRules{Categories: []int{999}}}},
+		{"smart category", Category{Name: "Nineties", Rules: &CategoryRules{ExcludeCategories: []int{smart.ID}}}},
+		{"unknown person", Category{Name: "Nineties", Rules: &CategoryRules{DirectorID: 999}}},
+	}
+	for _, tt := range bad {
+		t.Run("create with "+tt.name, func(t *testing.T) {
+			ts.expect(ts.do("POST", "/categories", admin, tt.category), http.StatusBadRequest, nil)
+		})
+		t.Run("update with "+tt.name, func(t *testing.T) {
+			ts.expect(ts.do("PUT", categoryPath(smart.ID, ""), admin, tt.category), http.StatusBadRequest, nil)
+		})
+	}
+
+	ts.expect(ts.do("PUT", categoryPath(smart.ID, ""), admin, Category{Name: "Eighties"}), http.StatusConflict, nil)
+	ts.expect(ts.do("PUT", categoryPath(regular.ID, ""), admin, Category{Name: "Drama", Rules: &CategoryRules{YearFrom: 1980}}), http.StatusConflict, nil)
+	ts.expect(ts.do("POST", categoryPath(smart.ID, "/move"), admin, map[string]int{"parent_id": regular.ID}), http.StatusConflict, nil)
+	ts.expect(ts.do("POST", categoryPath(smart.ID, "/merge-into/"+strconv.Itoa(regular.ID)), admin, nil), http.StatusConflict, nil)
+	ts.expect(ts.do("POST", categoryPath(regular.ID, "/merge-into/"+strconv.Itoa(smart.ID)), admin, nil), http.StatusConflict, nil)
+
+	movie := testMovie("Blade Runner", 1982)
+	movie.Categories = []Category{{Name: "Eighties"}}
+	ts.expect(ts.do("POST", "/movies", admin, movie), http.StatusConflict, nil)
+
+	var updated Category
+	ts.expect(ts.do("PUT", categoryPath(smart.ID, ""), admin, Category{Name: "1980s", Rules: &CategoryRules{YearFrom: 1980, YearTo: 1989}}), http.StatusOK, &updated)
+	if updated.Name != "1980s" || updated.Rules == nil || updated.ParentID != nil {
+		t.Errorf("updated = %+v", updated)
+	}
+}
+
+func TestSmartCategoryRulesNameCategories(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		drama := ts.createCategory(admin, Category{Name: "Drama"})
+		war := ts.createCategory(admin, Category{Name: "War", ParentID: &drama.ID})
+		comedy := ts.createCategory(admin, Category{Name: "Comedy"})
+		satire := ts.createCategory(admin, Category{Name: "Satire"})
+		unused := ts.createCategory(admin, Category{Name: "Unused"})
+		smart := ts.createCategory(admin, Category{Name: "Serious War", Rules: &CategoryRules{
+			Categories: []int{war.ID}, ExcludeCategories: []int{comedy.ID, satire.ID},
+		}})
+		movie := testMovie("Apocalypse Now", 1979)
+		movie.Categories = []Category{{Name: "War"}}
+		ts.createMovie(admin, movie)
+
+		// Categories the rules name are kept, with their ancestors.
+		ts.expect(ts.do("POST", "/categories/cleanup", admin, nil), http.StatusOK, nil)
+		var flat []Category
+		ts.expect(ts.do("GET", "/categories?flat=true&include_empty=true", "", nil), http.StatusOK, &flat)
+		var names []string
+		for _, c := range flat {
+			names = append(names, c.Name)
+		}
+		sort.Strings(names)
+		if want := []string{"Comedy", "Drama", "Satire", "Serious War", "War"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("categories after cleanup = %q, want %q", names, want)
+		}
+		ts.expect(ts.do("DELETE", categoryPath(unused.ID, ""), admin, nil), http.StatusNotFound, nil)
+
+		// Deleting a named category fails, even with force, naming the
+		// smart category.
+		for _, query := range []string{"", "?force=true"} {
+			var conflict CategoryConflictError
+			ts.expect(ts.do("DELETE", categoryPath(comedy.ID, query), admin, nil), http.StatusConflict, &conflict)
+			if conflict.Reason != "in_rules" || conflict.CategoryID != smart.ID {
+				t.Errorf("delete%s: conflict = %+v", query, conflict)
+			}
+		}
+
+		// Merging renames the category in the rules, naming it once.
+		ts.expect(ts.do("DELETE", categoryPath(satire.ID, "?reassign_to="+strconv.Itoa(comedy.ID)), admin, nil), http.StatusOK, nil)
+		rules := ts.category(smart.ID).Rules
+		if rules == nil || !reflect.DeepEqual(rules.ExcludeCategories, []int{comedy.ID}) {
+			t.Errorf("rules after merging Satire into Comedy = %+v", rules)
+		}
+
+		// Unless the rules would then require and exclude the target.
+		ts.expect(ts.do("POST", categoryPath(war.ID, "/merge-into/"+strconv.Itoa(comedy.ID)), admin, nil), http.StatusConflict, nil)
+		if got := ts.smartMovieTitles(smart.ID); !reflect.DeepEqual(got, []string{"Apocalypse Now"}) {
+			t.Errorf("movies = %q after a failed merge", got)
+		}
+
+		ts.expect(ts.do("DELETE", categoryPath(smart.ID, ""), admin, nil), http.StatusOK, nil)
+		ts.expect(ts.do("DELETE", categoryPath(comedy.ID, ""), admin, nil), http.StatusOK, nil)
+	})
+}
+
+func TestSmartCategoryRulesNamePeople(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		alien := ts.createMovie(admin, testMovie("Alien", 1979))
+		scott := alien.Director.ID
+		smart := ts.createCategory(admin, Category{Name: "Scott", Rules: &CategoryRules{DirectorID: scott}})
+
+		// A director left without movies is kept while rules name them.
+		update := testMovie("Alien", 1979)
+		update.Director = Director{Firstname: "Dan", Lastname: "O'Bannon"}
+		ts.expect(ts.do("PUT", "/movies/"+alien.ID, admin, update), http.StatusOK, nil)
+		ts.expect(ts.do("GET", "/directors/"+strconv.Itoa(scott), "", nil), http.StatusOK, nil)
+		ts.expect(ts.do("DELETE", "/directors/"+strconv.Itoa(scott), admin, nil), http.StatusConflict, nil)
+
+		// Merging makes the rules name the surviving director.
+		movie := testMovie("Blade Runner", 1982)
+		movie.Director = Director{Firstname: "R.", Lastname: "Scott"}
+		bladeRunner := ts.createMovie(admin, movie)
+		into := bladeRunner.Director.ID
+		ts.expect(ts.do("POST", "/directors/"+strconv.Itoa(scott)+"/merge-into/"+strconv.Itoa(into), admin, nil), http.StatusOK, nil)
+		if rules := ts.category(smart.ID).Rules; rules == nil || rules.DirectorID != into {
+			t.Errorf("rules after the merge = %+v, want director_id %d", rules, into)
+		}
+		if got := ts.smartMovieTitles(smart.ID); !reflect.DeepEqual(got, []string{"Blade Runner"}) {
+			t.Errorf("movies = %q", got)
+		}
+	})
+}
+
+func TestReplaceCategory(t *testing.T) {
+	r := CategoryRules{Categories: []int{1, 2}, ExcludeCategories: []int{3}}
+	got := r.replaceCategory(1, 2)
+	if want := (CategoryRules{Categories: []int{2}, ExcludeCategories: []int{3}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("replacing 1 with 2 = %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(r.Categories, []int{1, 2}) {
+		t.Errorf("the original rules changed: %+v", r)
+	}
+	if _, err := mergedRules(10, r, 3, 1); !errors.Is(err, ErrConflict) {
+		t.Errorf("merging an excluded category into a required one: err = %v, want a conflict", err)
+	}
+	if !r.namesCategory(3) || r.namesCategory(4) {
+		t.Error("namesCategory is wrong")
+	}
+}
+
+func TestAddRules(t *testing.T) {
+	where := &whereBuilder{}
+	where.addRules(CategoryRules{YearFrom: 1980, Language: "fr", Categories: []int{3}, ExcludeCategories: []int{4}})
+
+	if want := []interface{}{1980, "fr", 3, 4}; !reflect.DeepEqual(where.args, want) {
+		t.Errorf("args = %v, want %v", where.args, want)
+	}
+	if len(where.conds) != 4 {
+		t.Fatalf("conditions = %q", where.conds)
+	}
+	for i, want := range []string{"m.year >= $1", "m.original_language = $2", "SELECT $3::int", "NOT EXISTS"} {
+		if !strings.Contains(where.conds[i], want) {
+			t.Errorf("condition %d = %q, want it to contain %q", i, where.conds[i], want)
+		}
+	}
+	if strings.Contains(where.conds[2], "NOT EXISTS") || !strings.Contains(where.conds[3], "SELECT $4::int") {
+		t.Errorf("included and excluded categories are mixed up: %q", where.conds[2:])
+	}
+}
+
+func TestSmartCountQuery(t *testing.T) {
+	query, args := smartCountQuery(map[int]CategoryRules{
+		10: {YearFrom: 1980, YearTo: 1989},
+		20: {Categories: []int{3}, ExcludeCategories: []int{4}},
+		30: {Country: "FR"},
+	})
+	if n := strings.Count(query, "UNION ALL"); n != 2 {
+		t.Errorf("%d UNION ALLs, want 2: %s", n, query)
+	}
+
+	// Every argument is used, in order, and the ids are among them.
+	if len(args) != 8 {
+		t.Fatalf("args = %v", args)
+	}
+	for i := range args {
+		if !strings.Contains(query, "$"+strconv.Itoa(i+1)) {
+			t.Errorf("$%d is unused: %s", i+1, query)
+		}
+	}
+	if strings.Contains(query, "$"+strconv.Itoa(len(args)+1)) {
+		t.Errorf("query uses more than %d arguments: %s", len(args), query)
+	}
+	ids := map[interface{}]bool{}
+	for _, a := range args {
+		ids[a] = true
+	}
+	for _, id := range []int{10, 20, 30} {
+		if !ids[id] {
+			t.Errorf("category %d is not among the arguments %v", id, args)
+		}
+	}
+
+	if query, args := smartCountQuery(nil); query != "" || len(args) != 0 {
+		t.Errorf("no rules: %q, %v", query, args)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned by a store when the requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned, wrapped with the details, when a change would
+// duplicate a name or orphan records that refer to the one being changed.
+var ErrConflict = errors.New("conflict")
+
+// CategoryConflictError is the ErrConflict of a category change that the
+// client can resolve. Reason is "name_taken", CategoryID then being the
+// category holding the name, "in_use", Movies then counting the movies
+// still in category CategoryID, or "in_rules", CategoryID then being a
+// smart category whose rules name the category.
+type CategoryConflictError struct {
+	Reason     string `json:"reason"`
+	Message    string `json:"message"`
+	CategoryID int    `json:"category_id"`
+	Movies     int    `json:"movies,omitempty"`
+}
+
+func (e *CategoryConflictError) Error() string { return "conflict: " + e.Message }
+
+func (e *CategoryConflictError) Unwrap() error { return ErrConflict }
+
+func categoryNameTaken(name string, id int) error {
+	return &CategoryConflictError{
+		Reason:     "name_taken",
+		Message:    fmt.Sprintf("category %q already exists", name),
+		CategoryID: id,
+	}
+}
+
+func categoryInUse(id, movies int) error {
+	return &CategoryConflictError{
+		Reason:     "in_use",
+		Message:    fmt.Sprintf("category %d still has %d movie(s)", id, movies),
+		CategoryID: id,
+		Movies:     movies,
+	}
+}
+
+func categoryInRules(id, smartID int) error {
+	return &CategoryConflictError{
+		Reason:     "in_rules",
+		Message:    fmt.Sprintf("category %d is named in the rules of smart category %d", id, smartID),
+		CategoryID: smartID,
+	}
+}
+
+// MovieStore persists movies together with their director and categories.
+type MovieStore interface {
+	ListMovies(ctx context.Context, opts ListOptions) (MoviePage, error)
+	GetMovie(ctx context.Context, id int) (Movie, error)
+	GetMovieByMID(ctx context.Context, mid string) (Movie, error)
+	// SearchMovies returns movies matching every term, or resembling the
+	// query closely enough, with Rank and Snippet set.
+	SearchMovies(ctx context.Context, q SearchQuery, opts ListOptions) (MoviePage, error)
+	// SuggestQueries returns up to limit existing titles, director names and
+	// category names resembling text, best first.
+	SuggestQueries(ctx context.Context, text string, similarity float64, limit int) ([]string, error)
+	MoviesByCategory(ctx context.Context, categoryID int, opts ListOptions) (MoviePage, error)
+	// CreateMovie stores movie.MID, the generated MID, or the first
+	// midCandidate after it not already taken, and sets movie.MID to it.
+	CreateMovie(ctx context.Context, movie *Movie) error
+	// UpdateMovie links the movie to the director named in movie, creating
+	// it if needed, and deletes the previous director if it is left
+	// without movies and no smart category's rules name it. Other movies are never affected. The stored MID is
+	// kept and returned in movie.MID.
+	UpdateMovie(ctx context.Context, id int, movie *Movie) error
+	DeleteMovie(ctx context.Context, id int) error
+}
+
+// CategoryStore persists categories, which form a forest through their
+// ParentID.
+type CategoryStore interface {
+	// ListCategories returns, by sort order and name and with their
+	// MovieCount, the categories that have movies and their ancestors, or
+	// with includeEmpty every category. Children are left empty.
+	ListCategories(ctx context.Context, includeEmpty bool) ([]Category, error)
+	// GetCategory returns category id without its MovieCount.
+	GetCategory(ctx context.Context, id int) (Category, error)
+	// CreateCategory fails with ErrNotFound if the parent does not exist.
+	// Taking another category's name, here or in UpdateCategory, fails with
+	// a CategoryConflictError.
+	CreateCategory(ctx context.Context, category *Category) error
+	// UpdateCategory changes a category's name and presentation details;
+	// MoveCategory changes its parent.
+	UpdateCategory(ctx context.Context, id int, category *Category) error
+	// MoveCategory makes parentID, or nil for none, the parent of category
+	// id. Moving a category under itself or a descendant fails with
+	// ErrConflict.
+	MoveCategory(ctx context.Context, id int, parentID *int) (Category, error)
+	// MergeCategories moves the movies and children of category id to
+	// category intoID, and makes smart categories name intoID in its place,
+	// then deletes id. Merging a category into its own descendant, or
+	// leaving a smart category both requiring and excluding intoID, fails
+	// with ErrConflict.
+	MergeCategories(ctx context.Context, id, intoID int) (Category, error)
+	// DeleteCategory hands the category's children to its parent. A
+	// category movies are still in is only deleted, and taken off them,
+	// with force; otherwise it fails with a CategoryConflictError, as it
+	// always does while a smart category's rules name it.
+	DeleteCategory(ctx context.Context, id int, force bool) error
+	// CleanupEmptyCategories removes categories no movie refers to, unless
+	// a descendant has movies or a smart category's rules name it or a
+	// descendant.
+	CleanupEmptyCategories(ctx context.Context) error
+}
+
+// TagStore persists tags. Tags are created when a movie first names them
+// and deleted when no movie has them any more.
+type TagStore interface {
+	// ListTags returns every tag, with its MovieCount, by name.
+	ListTags(ctx context.Context) ([]Tag, error)
+	// RenameTag changes the name or its case. Taking the name of another
+	// tag fails with ErrConflict; MergeTags joins them instead.
+	RenameTag(ctx context.Context, id int, name string) (Tag, error)
+	// MergeTags moves the movies of tag id to tag intoID and deletes id.
+	MergeTags(ctx context.Context, id, intoID int) (Tag, error)
+	// DeleteTag takes the tag off every movie.
+	DeleteTag(ctx context.Context, id int) error
+}
+
+// RelationStore persists relations between movies. GetMovie and
+// GetMovieByMID return them from either side, in Movie.Relations.
+type RelationStore interface {
+	// AddRelation records that movie id is kind of movie relatedID, as
+	// given by storedRelation. It fails with ErrNotFound if either movie
+	// does not exist, and with ErrConflict if a movie would become a sequel
+	// of itself through a chain of sequels. Adding a relation again is a
+	// no-op.
+	AddRelation(ctx context.Context, id int, kind string, relatedID int) error
+	// RemoveRelation fails with ErrNotFound if the relation does not exist.
+	RemoveRelation(ctx context.Context, id int, kind string, relatedID int) error
+}
+
+// CollectionStore persists collections. Their movies are given and saved
+// by id, in order, and returned as references. A missing collection fails
+// with ErrNotFound itself, a missing movie with an error wrapping it.
+type CollectionStore interface {
+	// ListCollections returns every collection by name.
+	ListCollections(ctx context.Context) ([]Collection, error)
+	GetCollection(ctx context.Context, id int) (Collection, error)
+	// CreateCollection fails with ErrConflict if the name, regardless of
+	// case, is taken, as does UpdateCollection.
+	CreateCollection(ctx context.Context, c *Collection, movieIDs []int) error
+	// UpdateCollection replaces the name, description and movies.
+	UpdateCollection(ctx context.Context, id int, c *Collection, movieIDs []int) error
+	DeleteCollection(ctx context.Context, id int) error
+}
+
+// UserStore persists accounts and their login sessions, which are looked
+// up by tokenHash.
+type UserStore interface {
+	// CreateUser fails with ErrConflict if the username, regardless of
+	// case, is taken.
+	CreateUser(ctx context.Context, user *User, passwordHash string) error
+	// OIDCUser returns the user issuer knows by subject, creating them
+	// with username, which fails with ErrConflict if taken, on their first
+	// login.
+	OIDCUser(ctx context.Context, issuer, subject, username string) (User, error)
+	// SyncOIDCRoles makes roles the roles an OIDC provider grants the
+	// user: it grants those the user lacks and revokes those it granted
+	// before and no longer does. Roles granted with GrantRole are left be,
+	// and the last admin keeps the role.
+	SyncOIDCRoles(ctx context.Context, userID int, roles []string) (User, error)
+	// ListUsers returns every user by username.
+	ListUsers(ctx context.Context) ([]User, error)
+	// GetUser returns user id with their roles.
+	GetUser(ctx context.Context, id int) (User, error)
+	// GrantRole gives the user a grantableRole; granting it again is a
+	// no-op, except that a role the OIDC provider granted becomes one
+	// SyncOIDCRoles leaves be.
+	GrantRole(ctx context.Context, userID int, role string) (User, error)
+	// RevokeRole takes a role from the user. Revoking the last admin's
+	// role fails with ErrConflict.
+	RevokeRole(ctx context.Context, userID int, role string) (User, error)
+	// UserByName returns the account with the username, regardless of case,
+	// and its password hash.
+	UserByName(ctx context.Context, username string) (User, string, error)
+	// CreateSession logs the user in until expiresAt, dropping their expired
+	// sessions.
+	CreateSession(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// SessionUser returns the user of an unexpired session, or ErrNotFound.
+	SessionUser(ctx context.Context, tokenHash string) (User, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+}
+
+// APIKeyStore persists API keys, which are looked up by tokenHash.
+type APIKeyStore interface {
+	// ListAPIKeys returns every key, newest first, without Key.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	// CreateAPIKey stores key under hash, setting its ID and CreatedAt.
+	CreateAPIKey(ctx context.Context, key *APIKey, hash string) error
+	DeleteAPIKey(ctx context.Context, id int) error
+	// UseAPIKey returns the unexpired key stored under hash, or
+	// ErrNotFound, and records it as last used now.
+	UseAPIKey(ctx context.Context, hash string) (APIKey, error)
+}
+
+// DirectorStore persists directors: the people credited as a director, and
+// those created here not yet credited at all. People are unique by name,
+// which is how movies are linked to them.
+type DirectorStore interface {
+	ListDirectors(ctx context.Context) ([]Director, error)
+	// GetDirector returns the person with the id, whatever their roles.
+	GetDirector(ctx context.Context, id int) (Director, error)
+	CreateDirector(ctx context.Context, director *Director) error
+	// UpdateDirector renames a director on every movie it is credited on.
+	UpdateDirector(ctx context.Context, id int, director *Director) error
+	// DeleteDirector fails with ErrConflict while any movie credits the
+	// person or a smart category's rules name them.
+	DeleteDirector(ctx context.Context, id int) error
+	// MergeDirectors moves every movie of director id to director intoID,
+	// and makes smart categories' rules name intoID in its place, deletes
+	// id and returns the surviving director.
+	MergeDirectors(ctx context.Context, id, intoID int) (Director, error)
+}
+
+// Store is the full storage backend the server runs against.
+type Store interface {
+	MovieStore
+	CategoryStore
+	TagStore
+	RelationStore
+	CollectionStore
+	DirectorStore
+	UserStore
+	APIKeyStore
+	Autocomplete(ctx context.Context, req AutocompleteRequest) (Autocompletion, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
@@ -0,0 +1,1907 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryMovie is the stored form of a movie; people and categories are
+// held by id so that renames are visible from every movie.
+type memoryMovie struct {
+	id          int
+	mid         string
+	title       string
+	cover       string
+	directorID  int
+	credits     []memoryCredit
+	cast        []memoryCastMember
+	categoryIDs []int
+	tagIDs      []int
+	year        int
+	metadata    movieMetadata
+	createdAt   time.Time
+}
+
+// movieMetadata holds the descriptive fields of a Movie.
+type movieMetadata struct {
+	releaseDate      string
+	runtime          int
+	synopsis         string
+	originalLanguage string
+	countries        []string
+	contentRating    string
+}
+
+func metadataOf(movie *Movie) movieMetadata {
+	return movieMetadata{
+		releaseDate:      movie.ReleaseDate,
+		runtime:          movie.Runtime,
+		synopsis:         movie.Synopsis,
+		originalLanguage: movie.OriginalLanguage,
+		countries:        append([]string{}, movie.Countries...),
+		contentRating:    movie.ContentRating,
+	}
+}
+
+// memoryCredit is the stored form of a Credit.
+type memoryCredit struct {
+	personID int
+	role     string
+}
+
+// memoryCastMember is the stored form of a CastMember.
+type memoryCastMember struct {
+	personID  int
+	character string
+	billing   int
+}
+
+// memoryUser is the stored form of a User. Users logging in through OIDC
+// have an issuer and subject instead of a password hash.
+type memoryUser struct {
+	User
+	passwordHash string
+	oidcIssuer   string
+	oidcSubject  string
+	// oidcRoles are the Roles the OIDC provider granted.
+	oidcRoles map[string]bool
+}
+
+// user returns a copy of u that callers may change.
+func (u memoryUser) user() User {
+	user := u.User
+	user.Roles = append([]string{}, u.Roles...)
+	return user
+}
+
+// memorySession is a stored login session.
+type memorySession struct {
+	userID    int
+	expiresAt time.Time
+}
+
+// memoryAPIKey is the stored form of an APIKey.
+type memoryAPIKey struct {
+	APIKey
+	hash string
+}
+
+// apiKey returns a copy of k that callers may change.
+func (k memoryAPIKey) apiKey() APIKey {
+	key := k.APIKey
+	key.Scopes = append([]string{}, k.Scopes...)
+	return key
+}
+
+// memoryStore is a Store kept entirely in process memory. It mirrors the
+// behaviour of postgresStore and is intended for tests and local development.
+type memoryStore struct {
+	mu          sync.RWMutex
+	movies      map[int]*memoryMovie
+	people      map[int]Director
+	categories  map[int]Category
+	tags        map[int]string
+	relations   map[memoryRelation]bool
+	collections map[int]*memoryCollection
+	users       map[int]memoryUser
+	sessions    map[string]memorySession
+	apiKeys     map[int]memoryAPIKey
+	lastID      int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		movies:      make(map[int]*memoryMovie),
+		people:      make(map[int]Director),
+		categories:  make(map[int]Category),
+		tags:        make(map[int]string),
+		relations:   make(map[memoryRelation]bool),
+		collections: make(map[int]*memoryCollection),
+		users:       make(map[int]memoryUser),
+		sessions:    make(map[string]memorySession),
+		apiKeys:     make(map[int]memoryAPIKey),
+	}
+}
+
+func (s *memoryStore) Ping(ctx context.Context) error { return nil }
+
+func (s *memoryStore) Close() error { return nil }
+
+func (s *memoryStore) nextID() int {
+	s.lastID++
+	return s.lastID
+}
+
+// movie builds the public representation of m. Callers must hold s.mu.
+func (s *memoryStore) movie(m *memoryMovie) Movie {
+	movie := Movie{
+		ID:        strconv.Itoa(m.id),
+		MID:       m.mid,
+		Title:     m.title,
+		Cover:     m.cover,
+		Director:  s.people[m.directorID],
+		Year:      m.year,
+		CreatedAt: m.createdAt,
+
+		ReleaseDate:      m.metadata.releaseDate,
+		Runtime:          m.metadata.runtime,
+		Synopsis:         m.metadata.synopsis,
+		OriginalLanguage: m.metadata.originalLanguage,
+		Countries:        append([]string{}, m.metadata.countries...),
+		ContentRating:    m.metadata.contentRating,
+	}
+	for _, c := range m.credits {
+		p := s.people[c.personID]
+		movie.Credits = append(movie.Credits, Credit{PersonID: p.ID, Firstname: p.Firstname, Lastname: p.Lastname, Role: c.role})
+	}
+	for _, c := range m.cast {
+		p := s.people[c.personID]
+		movie.Cast = append(movie.Cast, CastMember{PersonID: p.ID, Firstname: p.Firstname, Lastname: p.Lastname,
+			Character: c.character, Billing: c.billing})
+	}
+	for _, id := range m.categoryIDs {
+		movie.Categories = append(movie.Categories, s.categories[id])
+	}
+	sort.Slice(movie.Categories, func(i, j int) bool { return movie.Categories[i].Name < movie.Categories[j].Name })
+	for _, id := range m.tagIDs {
+		movie.Tags = append(movie.Tags, s.tags[id])
+	}
+	sortTags(movie.Tags)
+	return movie
+}
+
+// findMovies pages through the movies matching keep and the filters of
+// opts, ordered like postgresStore.findMovies. Movie ranks are taken from
+// ranks, which keep may fill in. Callers must hold s.mu.
+func (s *memoryStore) findMovies(keep func(*memoryMovie) bool, opts ListOptions, ranks map[int]float64) MoviePage {
+	type keyed struct {
+		movie Movie
+		key   []interface{}
+		id    int64
+	}
+	compare := func(a, b keyed) int {
+		c := compareSortKeys(a.key, b.key)
+		if c == 0 && a.id != b.id {
+			c = 1
+			if a.id < b.id {
+				c = -1
+			}
+		}
+		if opts.Desc {
+			c = -c
+		}
+		return c
+	}
+
+	key := movieSorts[opts.Sort].key
+	var rows []keyed
+	for _, m := range s.movies {
+		if keep(m) && s.matchesFilters(m, opts) {
+			movie := s.movie(m)
+			movie.Rank = ranks[m.id]
+			rows = append(rows, keyed{movie: movie, key: key(movie), id: int64(m.id)})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return compare(rows[i], rows[j]) < 0 })
+
+	page := MoviePage{Total: len(rows)}
+	if len(opts.Facets) > 0 {
+		movies := make([]Movie, len(rows))
+		for i, r := range rows {
+			movies[i] = r.movie
+		}
+		page.Facets = computeFacets(movies, opts.Facets)
+	}
+	if opts.After != nil {
+		after := keyed{key: opts.After.Key, id: opts.After.ID}
+		rows = rows[sort.Search(len(rows), func(i int) bool { return compare(rows[i], after) > 0 }):]
+	}
+	if opts.Offset >= len(rows) {
+		rows = nil
+	} else {
+		rows = rows[opts.Offset:]
+	}
+	if opts.Limit > 0 && len(rows) > opts.Limit {
+		rows = rows[:opts.Limit]
+		page.NextCursor = newMovieCursor(opts, rows[opts.Limit-1].movie)
+	}
+	for _, r := range rows {
+		page.Movies = append(page.Movies, r.movie)
+	}
+	return page
+}
+
+// matchesFilters reports whether m passes the filter fields of opts.
+// Callers must hold s.mu.
+func (s *memoryStore) matchesFilters(m *memoryMovie, opts ListOptions) bool {
+	if opts.Category != "" {
+		found := false
+		for _, id := range m.categoryIDs {
+			found = found || s.categoryWithin(id, opts.Subcategories, func(c Category) bool {
+				return strconv.Itoa(c.ID) == opts.Category || strings.EqualFold(c.Name, opts.Category)
+			})
+		}
+		if !found {
+			return false
+		}
+	}
+	if opts.PersonID != 0 {
+		found := false
+		for _, id := range m.people() {
+			found = found || id == opts.PersonID
+		}
+		if !found {
+			return false
+		}
+	}
+	if opts.DirectorID != 0 && !m.credited(opts.DirectorID, "director") {
+		return false
+	}
+	if opts.HasCover != nil && (m.cover != "") != *opts.HasCover {
+		return false
+	}
+	md := m.metadata
+	if (opts.YearFrom != 0 && (m.year == 0 || m.year < opts.YearFrom)) ||
+		(opts.YearTo != 0 && (m.year == 0 || m.year > opts.YearTo)) ||
+		(opts.RuntimeMin != 0 && (md.runtime == 0 || md.runtime < opts.RuntimeMin)) ||
+		(opts.RuntimeMax != 0 && (md.runtime == 0 || md.runtime > opts.RuntimeMax)) {
+		return false
+	}
+	if (opts.Language != "" && md.originalLanguage != opts.Language) ||
+		(opts.ContentRating != "" && md.contentRating != opts.ContentRating) {
+		return false
+	}
+	for _, tag := range opts.Tags {
+		found := false
+		for _, id := range m.tagIDs {
+			found = found || strings.EqualFold(s.tags[id], tag)
+		}
+		if !found {
+			return false
+		}
+	}
+	if opts.Country != "" {
+		found := false
+		for _, c := range md.countries {
+			found = found || c == opts.Country
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *memoryStore) ListMovies(ctx context.Context, opts ListOptions) (MoviePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.findMovies(func(*memoryMovie) bool { return true }, opts, nil), nil
+}
+
+func (s *memoryStore) GetMovie(ctx context.Context, id int) (Movie, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.movies[id]
+	if !ok {
+		return Movie{}, ErrNotFound
+	}
+	return s.withLinks(s.movie(m), id), nil
+}
+
+// movieByMID returns the movie with the MID, or nil. Callers must hold
+// s.mu.
+func (s *memoryStore) movieByMID(mid string) *memoryMovie {
+	for _, m := range s.movies {
+		if m.mid == mid {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) GetMovieByMID(ctx context.Context, mid string) (Movie, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m := s.movieByMID(mid)
+	if m == nil {
+		return Movie{}, ErrNotFound
+	}
+	return s.withLinks(s.movie(m), m.id), nil
+}
+
+func (s *memoryStore) SearchMovies(ctx context.Context, sq SearchQuery, opts ListOptions) (MoviePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Field weights follow the defaults ts_rank uses for A, B, C and D.
+	const titleWeight, directorWeight, categoryWeight, peopleWeight = 1.0, 0.4, 0.2, 0.1
+	type field struct {
+		words  []string
+		weight float64
+	}
+	terms := sq.textTerms()
+	ranks := make(map[int]float64)
+	page := s.findMovies(func(m *memoryMovie) bool {
+		d := s.people[m.directorID]
+		title := field{splitWords(m.title), titleWeight}
+		director := field{splitWords(d.Firstname + " " + d.Lastname), directorWeight}
+		fields := []field{title, director}
+		for _, id := range m.categoryIDs {
+			fields = append(fields, field{splitWords(s.categories[id].Name), categoryWeight})
+		}
+		for _, id := range m.tagIDs {
+			fields = append(fields, field{splitWords(s.tags[id]), categoryWeight})
+		}
+		var actors []field
+		for _, c := range m.cast {
+			p := s.people[c.personID]
+			actors = append(actors, field{splitWords(p.Firstname + " " + p.Lastname), peopleWeight})
+		}
+		fields = append(fields, actors...)
+		for _, c := range m.credits {
+			p := s.people[c.personID]
+			fields = append(fields, field{splitWords(p.Firstname + " " + p.Lastname), peopleWeight})
+		}
+
+		// bestWeight is the weight of the heaviest field t matches, or 0.
+		bestWeight := func(t searchTerm) float64 {
+			best := 0.0
+			for _, f := range fields {
+				if f.weight > best && t.matchWords(f.words) >= 0 {
+					best = f.weight
+				}
+			}
+			return best
+		}
+
+		textMatched, filtersMatched := true, true
+		for _, c := range sq.Clauses {
+			var ok bool
+			switch c := c.(type) {
+			case *textClause:
+				ok = bestWeight(c.Term) > 0
+			case *fieldClause:
+				candidates := []field{title}
+				switch c.Field {
+				case "director":
+					candidates = []field{director}
+				case "actor":
+					candidates = actors
+				}
+				for _, f := range candidates {
+					ok = ok || c.Term.matchWords(f.words) >= 0
+				}
+			case *categoryClause:
+				for _, id := range m.categoryIDs {
+					name := strings.ToLower(s.categories[id].Name)
+					want := strings.ToLower(c.Name)
+					if name == want || (c.Prefix && strings.HasPrefix(name, want)) {
+						ok = true
+					}
+				}
+			case *tagClause:
+				for _, id := range m.tagIDs {
+					name := strings.ToLower(s.tags[id])
+					want := strings.ToLower(c.Name)
+					if name == want || (c.Prefix && strings.HasPrefix(name, want)) {
+						ok = true
+					}
+				}
+			case *yearClause:
+				ok = c.matchYear(m.year)
+			}
+
+			if _, text := c.(*textClause); text && !c.negated() {
+				textMatched = textMatched && ok
+			} else if ok == c.negated() {
+				filtersMatched = false
+			}
+		}
+
+		rank := 0.0
+		if len(terms) > 0 {
+			for _, t := range terms {
+				rank += bestWeight(t)
+			}
+			rank /= float64(len(terms))
+
+			if sq.Similarity > 0 {
+				text := sq.fuzzyText()
+				sim := math.Max(wordSimilarity(text, m.title), wordSimilarity(text, d.Firstname+" "+d.Lastname))
+				if sim >= sq.Similarity {
+					textMatched = true
+				}
+				rank += fuzzyRankWeight * sim
+			}
+		}
+
+		ranks[m.id] = rank
+		return textMatched && filtersMatched
+	}, opts, ranks)
+
+	highlight := sq.highlightTerms()
+	for i := range page.Movies {
+		page.Movies[i].Snippet = highlightTerms(s.snippetText(page.Movies[i]), highlight)
+	}
+	return page, nil
+}
+
+func (s *memoryStore) SuggestQueries(ctx context.Context, text string, similarity float64, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := make(map[string]float64)
+	consider := func(name string) {
+		if sim := wordSimilarity(text, name); sim >= similarity && sim > scores[name] {
+			scores[name] = sim
+		}
+	}
+	for _, m := range s.movies {
+		consider(m.title)
+	}
+	for _, p := range s.people {
+		consider(p.Firstname + " " + p.Lastname)
+	}
+	for _, c := range s.categories {
+		consider(c.Name)
+	}
+
+	var suggestions []string
+	for name := range scores {
+		suggestions = append(suggestions, name)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return a < b
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// snippetText is the text a search snippet is cut from, as in
+// postgresStore.attachSnippets.
+func (s *memoryStore) snippetText(m Movie) string {
+	parts := []string{m.Title, m.Director.Firstname + " " + m.Director.Lastname}
+	var names []string
+	for _, c := range m.Categories {
+		names = append(names, c.Name)
+	}
+	if len(names) > 0 {
+		parts = append(parts, strings.Join(names, ", "))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func (s *memoryStore) MoviesByCategory(ctx context.Context, categoryID int, opts ListOptions) (MoviePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rules := s.categories[categoryID].Rules; rules != nil {
+		return s.findMovies(func(m *memoryMovie) bool { return s.matchesRules(m, *rules) }, opts, nil), nil
+	}
+	return s.findMovies(func(m *memoryMovie) bool {
+		for _, id := range m.categoryIDs {
+			if s.categoryWithin(id, opts.Subcategories, func(c Category) bool { return c.ID == categoryID }) {
+				return true
+			}
+		}
+		return false
+	}, opts, nil), nil
+}
+
+// matchesRules reports whether m belongs to a smart category with rules.
+// Callers must hold s.mu.
+func (s *memoryStore) matchesRules(m *memoryMovie, rules CategoryRules) bool {
+	if !s.matchesFilters(m, rules.filters()) {
+		return false
+	}
+	in := func(categoryID int) bool {
+		for _, id := range m.categoryIDs {
+			if s.categoryWithin(id, true, func(c Category) bool { return c.ID == categoryID }) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, id := range rules.Categories {
+		if !in(id) {
+			return false
+		}
+	}
+	for _, id := range rules.ExcludeCategories {
+		if in(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// assignable checks that no category is a smart one. Callers must hold
+// s.mu.
+func (s *memoryStore) assignable(categories []Category) error {
+	for _, c := range categories {
+		if id := s.categoryByName(c.Name); id != 0 && s.categories[id].Rules != nil {
+			return smartCategoryConflict(id, "movies cannot be assigned to")
+		}
+	}
+	return nil
+}
+
+// categoryWithin reports whether category id, or with subcategories any
+// of its ancestors, matches. Callers must hold s.mu.
+func (s *memoryStore) categoryWithin(id int, subcategories bool, match func(Category) bool) bool {
+	for {
+		c, ok := s.categories[id]
+		if !ok {
+			return false
+		}
+		if match(c) {
+			return true
+		}
+		if !subcategories || c.ParentID == nil {
+			return false
+		}
+		id = *c.ParentID
+	}
+}
+
+// categoryIDs resolves categories by name, creating missing ones.
+// Callers must hold s.mu for writing.
+func (s *memoryStore) categoryIDs(categories []Category) []int {
+	var ids []int
+	for _, category := range categories {
+		id := s.categoryByName(category.Name)
+		if id == 0 {
+			id = s.nextID()
+			s.categories[id] = Category{ID: id, Name: category.Name}
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// linkTags resolves tags by name regardless of case, creating missing
+// ones, and respells tags as stored. Callers must hold s.mu for writing.
+func (s *memoryStore) linkTags(tags []string) []int {
+	var ids []int
+	for i, name := range tags {
+		id := s.tagByName(name)
+		if id == 0 {
+			id = s.nextID()
+			s.tags[id] = name
+		}
+		tags[i] = s.tags[id]
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (s *memoryStore) tagByName(name string) int {
+	for id, t := range s.tags {
+		if strings.EqualFold(t, name) {
+			return id
+		}
+	}
+	return 0
+}
+
+// tagMovies counts the movies tagged id. Callers must hold s.mu.
+func (s *memoryStore) tagMovies(id int) int {
+	n := 0
+	for _, m := range s.movies {
+		for _, t := range m.tagIDs {
+			if t == id {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// deleteOrphanTags deletes those of the given tags no movie has. Callers
+// must hold s.mu for writing.
+func (s *memoryStore) deleteOrphanTags(ids []int) {
+	for _, id := range ids {
+		if s.tagMovies(id) == 0 {
+			delete(s.tags, id)
+		}
+	}
+}
+
+func (s *memoryStore) categoryByName(name string) int {
+	for id, c := range s.categories {
+		if c.Name == name {
+			return id
+		}
+	}
+	return 0
+}
+
+// resolvePerson returns the id of the person with the given name,
+// creating them if there is none. Callers must hold s.mu for writing.
+func (s *memoryStore) resolvePerson(firstname, lastname string) int {
+	id := s.personByName(firstname, lastname)
+	if id == 0 {
+		id = s.nextID()
+		s.people[id] = Director{ID: id, Firstname: firstname, Lastname: lastname}
+	}
+	return id
+}
+
+// linkCredits resolves the people credited by name, setting
+// Credit.PersonID. Callers must hold s.mu for writing.
+func (s *memoryStore) linkCredits(credits []Credit) []memoryCredit {
+	var linked []memoryCredit
+	for i := range credits {
+		credits[i].PersonID = s.resolvePerson(credits[i].Firstname, credits[i].Lastname)
+		linked = append(linked, memoryCredit{personID: credits[i].PersonID, role: credits[i].Role})
+	}
+	return linked
+}
+
+// linkCast resolves the cast by name, setting CastMember.PersonID.
+// Callers must hold s.mu for writing.
+func (s *memoryStore) linkCast(cast []CastMember) []memoryCastMember {
+	var linked []memoryCastMember
+	for i := range cast {
+		cast[i].PersonID = s.resolvePerson(cast[i].Firstname, cast[i].Lastname)
+		linked = append(linked, memoryCastMember{personID: cast[i].PersonID, character: cast[i].Character, billing: cast[i].Billing})
+	}
+	return linked
+}
+
+// people returns the ids of everyone credited or cast on m, including its
+// primary director.
+func (m *memoryMovie) people() []int {
+	ids := []int{m.directorID}
+	for _, c := range m.credits {
+		ids = append(ids, c.personID)
+	}
+	for _, c := range m.cast {
+		ids = append(ids, c.personID)
+	}
+	return ids
+}
+
+// credited reports whether the person is credited on m in role.
+func (m *memoryMovie) credited(personID int, role string) bool {
+	for _, c := range m.credits {
+		if c.personID == personID && c.role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteOrphanPeople deletes those of the given people no movie credits or
+// casts any more, and no smart category's rules name. Callers must hold
+// s.mu for writing.
+func (s *memoryStore) deleteOrphanPeople(ids []int) {
+	for _, id := range ids {
+		if s.personMovies(id) == 0 && s.rulesNamingPerson(id) == 0 {
+			delete(s.people, id)
+		}
+	}
+}
+
+// rulesNamingPerson returns the lowest id of the smart categories whose
+// rules name person id, or 0. Callers must hold s.mu.
+func (s *memoryStore) rulesNamingPerson(id int) int {
+	smartID := 0
+	for _, c := range s.categories {
+		if c.Rules != nil && c.Rules.namesPerson(id) && (smartID == 0 || c.ID < smartID) {
+			smartID = c.ID
+		}
+	}
+	return smartID
+}
+
+func (s *memoryStore) CreateMovie(ctx context.Context, movie *Movie) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.assignable(movie.Categories); err != nil {
+		return err
+	}
+	movie.Director.ID = s.resolvePerson(movie.Director.Firstname, movie.Director.Lastname)
+
+	base := movie.MID
+	for n := 1; ; n++ {
+		if movie.MID = midCandidate(base, n); s.movieByMID(movie.MID) == nil {
+			break
+		}
+	}
+
+	m := &memoryMovie{
+		id:          s.nextID(),
+		mid:         movie.MID,
+		title:       movie.Title,
+		cover:       movie.Cover,
+		directorID:  movie.Director.ID,
+		credits:     s.linkCredits(movie.Credits),
+		cast:        s.linkCast(movie.Cast),
+		categoryIDs: s.categoryIDs(movie.Categories),
+		tagIDs:      s.linkTags(movie.Tags),
+		year:        movie.Year,
+		metadata:    metadataOf(movie),
+		createdAt:   time.Now().UTC().Truncate(time.Microsecond),
+	}
+	s.movies[m.id] = m
+	movie.ID = strconv.Itoa(m.id)
+	movie.CreatedAt = m.createdAt
+	return nil
+}
+
+func (s *memoryStore) UpdateMovie(ctx context.Context, id int, movie *Movie) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.movies[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := s.assignable(movie.Categories); err != nil {
+		return err
+	}
+	previous := m.people()
+	movie.MID = m.mid
+	m.title = movie.Title
+	m.cover = movie.Cover
+	m.year = movie.Year
+	m.metadata = metadataOf(movie)
+	// People are matched by name like on create; renaming a director for
+	// every movie is UpdateDirector's job.
+	movie.Director.ID = s.resolvePerson(movie.Director.Firstname, movie.Director.Lastname)
+	m.directorID = movie.Director.ID
+	m.credits = s.linkCredits(movie.Credits)
+	m.cast = s.linkCast(movie.Cast)
+	s.deleteOrphanPeople(previous)
+	previousTags := m.tagIDs
+	m.tagIDs = s.linkTags(movie.Tags)
+	s.deleteOrphanTags(previousTags)
+	m.categoryIDs = s.categoryIDs(movie.Categories)
+	movie.ID = strconv.Itoa(id)
+	movie.CreatedAt = m.createdAt
+	return nil
+}
+
+func (s *memoryStore) DeleteMovie(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.movies[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.movies, id)
+	s.unlinkMovie(id)
+
+	//Delete the people no other movies credit
+	s.deleteOrphanPeople(m.people())
+	s.deleteOrphanTags(m.tagIDs)
+	return nil
+}
+
+// personMovies counts the movies crediting or casting a person. Callers
+// must hold s.mu.
+func (s *memoryStore) personMovies(id int) int {
+	n := 0
+	for _, m := range s.movies {
+		for _, p := range m.people() {
+			if p == id {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// personByName returns the id of the person with the given name, or 0.
+// Callers must hold s.mu.
+func (s *memoryStore) personByName(firstname, lastname string) int {
+	for id, p := range s.people {
+		if p.Firstname == firstname && p.Lastname == lastname {
+			return id
+		}
+	}
+	return 0
+}
+
+func (s *memoryStore) ListDirectors(ctx context.Context) ([]Director, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// People credited only in other roles are not directors; people not
+	// credited at all were created through /directors.
+	directing := make(map[int]bool)
+	for _, m := range s.movies {
+		for _, c := range m.credits {
+			directing[c.personID] = directing[c.personID] || c.role == "director"
+		}
+		for _, c := range m.cast {
+			if _, ok := directing[c.personID]; !ok {
+				directing[c.personID] = false
+			}
+		}
+	}
+	var directors []Director
+	for id, p := range s.people {
+		if isDirector, credited := directing[id]; isDirector || !credited {
+			directors = append(directors, p)
+		}
+	}
+	sort.Slice(directors, func(i, j int) bool {
+		a, b := directors[i], directors[j]
+		if a.Lastname != b.Lastname {
+			return a.Lastname < b.Lastname
+		}
+		if a.Firstname != b.Firstname {
+			return a.Firstname < b.Firstname
+		}
+		return a.ID < b.ID
+	})
+	return directors, nil
+}
+
+func (s *memoryStore) GetDirector(ctx context.Context, id int) (Director, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.people[id]
+	if !ok {
+		return Director{ID: id}, ErrNotFound
+	}
+	return d, nil
+}
+
+func (s *memoryStore) CreateDirector(ctx context.Context, director *Director) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.personByName(director.Firstname, director.Lastname) != 0 {
+		return fmt.Errorf("%w: director %s %s already exists", ErrConflict, director.Firstname, director.Lastname)
+	}
+	director.ID = s.nextID()
+	s.people[director.ID] = *director
+	return nil
+}
+
+func (s *memoryStore) UpdateDirector(ctx context.Context, id int, director *Director) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.people[id]; !ok {
+		return ErrNotFound
+	}
+	if other := s.personByName(director.Firstname, director.Lastname); other != 0 && other != id {
+		return fmt.Errorf("%w: director %s %s already exists", ErrConflict, director.Firstname, director.Lastname)
+	}
+	director.ID = id
+	s.people[id] = *director
+	return nil
+}
+
+func (s *memoryStore) DeleteDirector(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.people[id]; !ok {
+		return ErrNotFound
+	}
+	if n := s.personMovies(id); n > 0 {
+		return fmt.Errorf("%w: director %d is credited on %d movies", ErrConflict, id, n)
+	}
+	if smartID := s.rulesNamingPerson(id); smartID != 0 {
+		return fmt.Errorf("%w: director %d is named in the rules of smart category %d", ErrConflict, id, smartID)
+	}
+	delete(s.people, id)
+	return nil
+}
+
+func (s *memoryStore) MergeDirectors(ctx context.Context, id, intoID int) (Director, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	into, ok := s.people[intoID]
+	if _, found := s.people[id]; !ok || !found {
+		return into, ErrNotFound
+	}
+	for _, m := range s.movies {
+		if m.directorID == id {
+			m.directorID = intoID
+		}
+		// Credits the target already holds in the same role are dropped.
+		var credits []memoryCredit
+		for _, c := range m.credits {
+			if c.personID == id {
+				c.personID = intoID
+			}
+			if c.personID != intoID || !creditIn(credits, c) {
+				credits = append(credits, c)
+			}
+		}
+		m.credits = credits
+		for i := range m.cast {
+			if m.cast[i].personID == id {
+				m.cast[i].personID = intoID
+			}
+		}
+	}
+	for categoryID, c := range s.categories {
+		if c.Rules != nil && c.Rules.namesPerson(id) {
+			rules := c.Rules.replacePerson(id, intoID)
+			c.Rules = &rules
+			s.categories[categoryID] = c
+		}
+	}
+	delete(s.people, id)
+	return into, nil
+}
+
+// creditIn reports whether credits contains c.
+func creditIn(credits []memoryCredit, c memoryCredit) bool {
+	for _, other := range credits {
+		if other == c {
+			return true
+		}
+	}
+	return false
+}
+
+// usedCategories reports which categories are attached to at least one movie.
+// Callers must hold s.mu.
+func (s *memoryStore) usedCategories() map[int]bool {
+	used := make(map[int]bool)
+	for _, m := range s.movies {
+		for _, id := range m.categoryIDs {
+			used[id] = true
+		}
+	}
+	return used
+}
+
+// liveCategories reports which categories are used or have a used
+// descendant. Callers must hold s.mu.
+func (s *memoryStore) liveCategories() map[int]bool {
+	return s.withAncestors(s.usedCategories())
+}
+
+// withAncestors returns the given categories and all their ancestors.
+// Callers must hold s.mu.
+func (s *memoryStore) withAncestors(ids map[int]bool) map[int]bool {
+	all := make(map[int]bool)
+	for id := range ids {
+		for !all[id] {
+			all[id] = true
+			if parent := s.categories[id].ParentID; parent != nil {
+				id = *parent
+			}
+		}
+	}
+	return all
+}
+
+// rulesNaming returns, by id, the smart categories whose rules name
+// category id. Callers must hold s.mu.
+func (s *memoryStore) rulesNaming(id int) []Category {
+	var smart []Category
+	for _, c := range s.categories {
+		if c.Rules != nil && c.Rules.namesCategory(id) {
+			smart = append(smart, c)
+		}
+	}
+	sort.Slice(smart, func(i, j int) bool { return smart[i].ID < smart[j].ID })
+	return smart
+}
+
+func (s *memoryStore) ListCategories(ctx context.Context, includeEmpty bool) ([]Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[int]int)
+	for _, m := range s.movies {
+		for _, id := range m.categoryIDs {
+			counts[id]++
+		}
+	}
+	live := s.liveCategories()
+	var categories []Category
+	for id, c := range s.categories {
+		if c.Rules != nil {
+			counts[id] = 0
+			for _, m := range s.movies {
+				if s.matchesRules(m, *c.Rules) {
+					counts[id]++
+				}
+			}
+		}
+		if includeEmpty || live[id] || c.Rules != nil {
+			movies := counts[id]
+			c.MovieCount = &movies
+			categories = append(categories, c)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		a, b := categories[i], categories[j]
+		if a.SortOrder != b.SortOrder {
+			return a.SortOrder < b.SortOrder
+		}
+		return a.Name < b.Name
+	})
+	return categories, nil
+}
+
+func (s *memoryStore) GetCategory(ctx context.Context, id int) (Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.categories[id]
+	if !ok {
+		return Category{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *memoryStore) CreateCategory(ctx context.Context, category *Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if other := s.categoryByName(category.Name); other != 0 {
+		return categoryNameTaken(category.Name, other)
+	}
+	if category.ParentID != nil {
+		parent, ok := s.categories[*category.ParentID]
+		if !ok {
+			return ErrNotFound
+		}
+		if parent.Rules != nil {
+			return smartCategoryConflict(parent.ID, "cannot have a parent or children")
+		}
+	}
+	category.ID = s.nextID()
+	category.MovieCount, category.Children = nil, nil
+	s.categories[category.ID] = *category
+	return nil
+}
+
+func (s *memoryStore) UpdateCategory(ctx context.Context, id int, category *Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.categories[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if other := s.categoryByName(category.Name); other != 0 && other != id {
+		return categoryNameTaken(category.Name, other)
+	}
+	if (existing.Rules == nil) != (category.Rules == nil) {
+		return fmt.Errorf("%w: category %d cannot change between regular and smart", ErrConflict, id)
+	}
+	existing.Name, existing.Rules = category.Name, category.Rules
+	existing.Description, existing.Color, existing.Icon = category.Description, category.Color, category.Icon
+	existing.SortOrder = category.SortOrder
+	s.categories[id] = existing
+	*category = existing
+	return nil
+}
+
+func (s *memoryStore) MoveCategory(ctx context.Context, id int, parentID *int) (Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	category, ok := s.categories[id]
+	if !ok {
+		return Category{}, ErrNotFound
+	}
+	if parentID != nil {
+		parent, ok := s.categories[*parentID]
+		if !ok {
+			return Category{}, ErrNotFound
+		}
+		for _, c := range []Category{category, parent} {
+			if c.Rules != nil {
+				return Category{}, smartCategoryConflict(c.ID, "cannot have a parent or children")
+			}
+		}
+		if s.categoryWithin(*parentID, true, func(c Category) bool { return c.ID == id }) {
+			return Category{}, fmt.Errorf("%w: category %d cannot be moved under itself or its descendant %d", ErrConflict, id, *parentID)
+		}
+		copied := *parentID
+		parentID = &copied
+	}
+	category.ParentID = parentID
+	s.categories[id] = category
+	return category, nil
+}
+
+// recategorize moves the movies and children of category id to category
+// intoID, or with intoID 0 takes the category off its movies and hands its
+// children to its parent. Callers must hold s.mu for writing.
+func (s *memoryStore) recategorize(id, intoID int) {
+	for _, m := range s.movies {
+		ids := m.categoryIDs[:0]
+		seen := make(map[int]bool)
+		for _, c := range m.categoryIDs {
+			if c == id {
+				c = intoID
+			}
+			if c != 0 && !seen[c] {
+				seen[c] = true
+				ids = append(ids, c)
+			}
+		}
+		m.categoryIDs = ids
+	}
+
+	parentID := s.categories[id].ParentID
+	if intoID != 0 {
+		parentID = &intoID
+	}
+	for childID, c := range s.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			c.ParentID = parentID
+			s.categories[childID] = c
+		}
+	}
+}
+
+func (s *memoryStore) MergeCategories(ctx context.Context, id, intoID int) (Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	into, ok := s.categories[intoID]
+	category, found := s.categories[id]
+	if !found || !ok {
+		return Category{}, ErrNotFound
+	}
+	if s.categoryWithin(intoID, true, func(c Category) bool { return c.ID == id }) {
+		return Category{}, fmt.Errorf("%w: category %d cannot be merged into itself or its descendant %d", ErrConflict, id, intoID)
+	}
+	for _, c := range []Category{category, into} {
+		if c.Rules != nil {
+			return Category{}, smartCategoryConflict(c.ID, "cannot be merged")
+		}
+	}
+	merged := make(map[int]CategoryRules)
+	for _, c := range s.rulesNaming(id) {
+		rules, err := mergedRules(c.ID, *c.Rules, id, intoID)
+		if err != nil {
+			return Category{}, err
+		}
+		merged[c.ID] = rules
+	}
+	for smartID, rules := range merged {
+		c := s.categories[smartID]
+		rules := rules
+		c.Rules = &rules
+		s.categories[smartID] = c
+	}
+	s.recategorize(id, intoID)
+	delete(s.categories, id)
+	return into, nil
+}
+
+func (s *memoryStore) DeleteCategory(ctx context.Context, id int, force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.categories[id]; !ok {
+		return ErrNotFound
+	}
+	if smart := s.rulesNaming(id); len(smart) > 0 {
+		return categoryInRules(id, smart[0].ID)
+	}
+	movies := 0
+	for _, m := range s.movies {
+		for _, c := range m.categoryIDs {
+			if c == id {
+				movies++
+			}
+		}
+	}
+	if movies > 0 && !force {
+		return categoryInUse(id, movies)
+	}
+	s.recategorize(id, 0)
+	delete(s.categories, id)
+	return nil
+}
+
+func (s *memoryStore) CleanupEmptyCategories(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keep := s.usedCategories()
+	for _, c := range s.categories {
+		if c.Rules != nil {
+			for _, id := range append(append([]int{}, c.Rules.Categories...), c.Rules.ExcludeCategories...) {
+				keep[id] = true
+			}
+		}
+	}
+	live := s.withAncestors(keep)
+	for id, c := range s.categories {
+		if !live[id] && c.Rules == nil {
+			delete(s.categories, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ListTags(ctx context.Context) ([]Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tags := []Tag{}
+	for id, name := range s.tags {
+		tags = append(tags, Tag{ID: id, Name: name, MovieCount: s.tagMovies(id)})
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name) })
+	return tags, nil
+}
+
+func (s *memoryStore) RenameTag(ctx context.Context, id int, name string) (Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tags[id]; !ok {
+		return Tag{}, ErrNotFound
+	}
+	if other := s.tagByName(name); other != 0 && other != id {
+		return Tag{}, fmt.Errorf("%w: tag %q already exists as tag %d", ErrConflict, name, other)
+	}
+	s.tags[id] = name
+	return Tag{ID: id, Name: name, MovieCount: s.tagMovies(id)}, nil
+}
+
+func (s *memoryStore) MergeTags(ctx context.Context, id, intoID int) (Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, found := s.tags[id]
+	into, ok := s.tags[intoID]
+	if !found || !ok {
+		return Tag{}, ErrNotFound
+	}
+	for _, m := range s.movies {
+		ids := m.tagIDs[:0]
+		seen := make(map[int]bool)
+		for _, t := range m.tagIDs {
+			if t == id {
+				t = intoID
+			}
+			if !seen[t] {
+				seen[t] = true
+				ids = append(ids, t)
+			}
+		}
+		m.tagIDs = ids
+	}
+	delete(s.tags, id)
+	return Tag{ID: intoID, Name: into, MovieCount: s.tagMovies(intoID)}, nil
+}
+
+func (s *memoryStore) DeleteTag(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tags[id]; !ok {
+		return ErrNotFound
+	}
+	for _, m := range s.movies {
+		ids := m.tagIDs[:0]
+		for _, t := range m.tagIDs {
+			if t != id {
+				ids = append(ids, t)
+			}
+		}
+		m.tagIDs = ids
+	}
+	delete(s.tags, id)
+	return nil
+}
+
+// memoryRelation is a stored relation, in the form of storedRelation.
+type memoryRelation struct {
+	movieID   int
+	kind      string
+	relatedID int
+}
+
+// memoryCollection is the stored form of a Collection.
+type memoryCollection struct {
+	name        string
+	description string
+	movieIDs    []int
+}
+
+// movieRef returns a reference to movie id. Callers must hold s.mu.
+func (s *memoryStore) movieRef(id int) MovieRef {
+	m := s.movies[id]
+	return MovieRef{ID: strconv.Itoa(id), MID: m.mid, Title: m.title, Year: m.year}
+}
+
+// withLinks sets the relations and collections of movie, the public
+// representation of movie id. Callers must hold s.mu.
+func (s *memoryStore) withLinks(movie Movie, id int) Movie {
+	for r := range s.relations {
+		if r.movieID == id {
+			movie.Relations = append(movie.Relations, Relation{Kind: r.kind, Movie: s.movieRef(r.relatedID)})
+		} else if r.relatedID == id {
+			movie.Relations = append(movie.Relations, Relation{Kind: relationInverses[r.kind], Movie: s.movieRef(r.movieID)})
+		}
+	}
+	sortRelations(movie.Relations)
+
+	for cid, c := range s.collections {
+		for i, m := range c.movieIDs {
+			if m == id {
+				movie.Collections = append(movie.Collections, CollectionRef{ID: cid, Name: c.name, Position: i + 1})
+			}
+		}
+	}
+	sort.Slice(movie.Collections, func(i, j int) bool {
+		return strings.ToLower(movie.Collections[i].Name) < strings.ToLower(movie.Collections[j].Name)
+	})
+	return movie
+}
+
+// unlinkMovie removes a deleted movie from every relation and collection.
+// Callers must hold s.mu.
+func (s *memoryStore) unlinkMovie(id int) {
+	for r := range s.relations {
+		if r.movieID == id || r.relatedID == id {
+			delete(s.relations, r)
+		}
+	}
+	for _, c := range s.collections {
+		ids := c.movieIDs[:0]
+		for _, m := range c.movieIDs {
+			if m != id {
+				ids = append(ids, m)
+			}
+		}
+		c.movieIDs = ids
+	}
+}
+
+// precedes reports whether a chain of sequels leads from movie later back
+// to movie earlier. Callers must hold s.mu.
+func (s *memoryStore) precedes(earlier, later int) bool {
+	seen := map[int]bool{later: true}
+	queue := []int{later}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == earlier {
+			return true
+		}
+		for r := range s.relations {
+			if r.kind == "sequel_of" && r.movieID == id && !seen[r.relatedID] {
+				seen[r.relatedID] = true
+				queue = append(queue, r.relatedID)
+			}
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) AddRelation(ctx context.Context, id int, kind string, relatedID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.movies[id] == nil || s.movies[relatedID] == nil {
+		return ErrNotFound
+	}
+	if kind == "sequel_of" && s.precedes(id, relatedID) {
+		return fmt.Errorf("%w: movie %d already precedes movie %d", ErrConflict, id, relatedID)
+	}
+	s.relations[memoryRelation{movieID: id, kind: kind, relatedID: relatedID}] = true
+	return nil
+}
+
+func (s *memoryStore) RemoveRelation(ctx context.Context, id int, kind string, relatedID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := memoryRelation{movieID: id, kind: kind, relatedID: relatedID}
+	if !s.relations[r] {
+		return ErrNotFound
+	}
+	delete(s.relations, r)
+	return nil
+}
+
+// collection builds the public representation of collection id. Callers
+// must hold s.mu.
+func (s *memoryStore) collection(id int) Collection {
+	c := s.collections[id]
+	collection := Collection{ID: id, Name: c.name, Description: c.description, Movies: []MovieRef{}}
+	for _, m := range c.movieIDs {
+		collection.Movies = append(collection.Movies, s.movieRef(m))
+	}
+	return collection
+}
+
+// collectionByName returns the id of the collection with the name,
+// regardless of case, or 0. Callers must hold s.mu.
+func (s *memoryStore) collectionByName(name string) int {
+	for id, c := range s.collections {
+		if strings.EqualFold(c.name, name) {
+			return id
+		}
+	}
+	return 0
+}
+
+// checkCollection validates a collection's name and movies before they are
+// stored as collection id, or a new one if id is 0. Callers must hold s.mu.
+func (s *memoryStore) checkCollection(id int, c *Collection, movieIDs []int) error {
+	if other := s.collectionByName(c.Name); other != 0 && other != id {
+		return fmt.Errorf("%w: collection %q already exists", ErrConflict, c.Name)
+	}
+	for _, m := range movieIDs {
+		if s.movies[m] == nil {
+			return fmt.Errorf("%w: movie %d", ErrNotFound, m)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ListCollections(ctx context.Context) ([]Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	collections := []Collection{}
+	for id := range s.collections {
+		collections = append(collections, s.collection(id))
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return strings.ToLower(collections[i].Name) < strings.ToLower(collections[j].Name)
+	})
+	return collections, nil
+}
+
+func (s *memoryStore) GetCollection(ctx context.Context, id int) (Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.collections[id]; !ok {
+		return Collection{}, ErrNotFound
+	}
+	return s.collection(id), nil
+}
+
+func (s *memoryStore) CreateCollection(ctx context.Context, c *Collection, movieIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCollection(0, c, movieIDs); err != nil {
+		return err
+	}
+	id := s.nextID()
+	s.collections[id] = &memoryCollection{name: c.Name, description: c.Description, movieIDs: append([]int{}, movieIDs...)}
+	*c = s.collection(id)
+	return nil
+}
+
+func (s *memoryStore) UpdateCollection(ctx context.Context, id int, c *Collection, movieIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.collections[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := s.checkCollection(id, c, movieIDs); err != nil {
+		return err
+	}
+	stored.name = c.Name
+	stored.description = c.Description
+	stored.movieIDs = append([]int{}, movieIDs...)
+	*c = s.collection(id)
+	return nil
+}
+
+func (s *memoryStore) DeleteCollection(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.collections, id)
+	return nil
+}
+
+func (s *memoryStore) Autocomplete(ctx context.Context, req AutocompleteRequest) (Autocompletion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(Autocompletion)
+	prefix := strings.ToLower(req.Prefix)
+	startsWith := func(name string) bool { return strings.HasPrefix(strings.ToLower(name), prefix) }
+
+	// rank orders items like the Postgres store: whole-name prefix matches
+	// first, then by less.
+	rank := func(items []AutocompleteItem, less func(a, b AutocompleteItem) bool) []AutocompleteItem {
+		sort.Slice(items, func(i, j int) bool {
+			a, b := items[i], items[j]
+			if pa, pb := startsWith(a.Label), startsWith(b.Label); pa != pb {
+				return pa
+			}
+			return less(a, b)
+		})
+		if len(items) > req.Limit {
+			items = items[:req.Limit]
+		}
+		return items
+	}
+
+	if req.Types["movie"] {
+		items := []AutocompleteItem{}
+		created := make(map[string]*memoryMovie)
+		for _, m := range s.movies {
+			if wordPrefixMatch(m.title, req.Prefix) {
+				id := strconv.Itoa(m.id)
+				created[id] = m
+				items = append(items, AutocompleteItem{ID: id, Label: m.title, Year: m.year})
+			}
+		}
+		result["movie"] = rank(items, func(a, b AutocompleteItem) bool {
+			ma, mb := created[a.ID], created[b.ID]
+			if !ma.createdAt.Equal(mb.createdAt) {
+				return ma.createdAt.After(mb.createdAt)
+			}
+			return ma.id > mb.id
+		})
+	}
+
+	if req.Types["director"] {
+		counts := make(map[int]int)
+		for _, m := range s.movies {
+			for _, c := range m.credits {
+				if c.role == "director" {
+					counts[c.personID]++
+				}
+			}
+		}
+		items := []AutocompleteItem{}
+		for id, d := range s.people {
+			name := d.Firstname + " " + d.Lastname
+			if counts[id] > 0 && wordPrefixMatch(name, req.Prefix) {
+				items = append(items, AutocompleteItem{ID: strconv.Itoa(id), Label: name, Count: counts[id]})
+			}
+		}
+		result["director"] = rank(items, func(a, b AutocompleteItem) bool {
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Label < b.Label
+		})
+	}
+
+	if req.Types["category"] {
+		counts := make(map[int]int)
+		for _, m := range s.movies {
+			for _, id := range m.categoryIDs {
+				counts[id]++
+			}
+		}
+		items := []AutocompleteItem{}
+		for id, c := range s.categories {
+			if wordPrefixMatch(c.Name, req.Prefix) {
+				items = append(items, AutocompleteItem{ID: strconv.Itoa(id), Label: c.Name, Count: counts[id]})
+			}
+		}
+		result["category"] = rank(items, func(a, b AutocompleteItem) bool {
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Label < b.Label
+		})
+	}
+	return result, nil
+}
+
+// userByName returns the account with the username, regardless of case.
+// Callers must hold s.mu.
+func (s *memoryStore) userByName(username string) (memoryUser, bool) {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return u, true
+		}
+	}
+	return memoryUser{}, false
+}
+
+// addUser stores a new user. Callers must hold s.mu.
+func (s *memoryStore) addUser(u memoryUser) (User, error) {
+	if _, ok := s.userByName(u.Username); ok {
+		return User{}, fmt.Errorf("%w: username %q is taken", ErrConflict, u.Username)
+	}
+	u.ID = s.nextID()
+	u.CreatedAt = time.Now()
+	u.Roles = []string{}
+	s.users[u.ID] = u
+	return u.user(), nil
+}
+
+func (s *memoryStore) CreateUser(ctx context.Context, user *User, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created, err := s.addUser(memoryUser{User: User{Username: user.Username}, passwordHash: passwordHash})
+	if err != nil {
+		return err
+	}
+	*user = created
+	return nil
+}
+
+func (s *memoryStore) OIDCUser(ctx context.Context, issuer, subject, username string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.oidcIssuer == issuer && u.oidcSubject == subject {
+			return u.user(), nil
+		}
+	}
+	return s.addUser(memoryUser{User: User{Username: username}, oidcIssuer: issuer, oidcSubject: subject})
+}
+
+func (s *memoryStore) SyncOIDCRoles(ctx context.Context, userID int, roles []string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	granted := make(map[string]bool)
+	for _, role := range roles {
+		granted[role] = true
+	}
+
+	oidcRoles := make(map[string]bool)
+	kept := []string{}
+	for _, role := range u.Roles {
+		if !u.oidcRoles[role] || granted[role] || role == roleAdmin && s.admins() == 1 {
+			kept = append(kept, role)
+			oidcRoles[role] = u.oidcRoles[role]
+		}
+	}
+	for _, role := range roles {
+		if _, ok := oidcRoles[role]; !ok {
+			kept = append(kept, role)
+			oidcRoles[role] = true
+		}
+	}
+	sortRoles(kept)
+	u.Roles, u.oidcRoles = kept, oidcRoles
+	s.users[userID] = u
+	return u.user(), nil
+}
+
+// admins counts the users holding the admin role. Callers must hold s.mu.
+func (s *memoryStore) admins() int {
+	n := 0
+	for _, u := range s.users {
+		if hasRole(u.User, roleAdmin) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *memoryStore) UserByName(ctx context.Context, username string) (User, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.userByName(username)
+	if !ok {
+		return User{}, "", ErrNotFound
+	}
+	return u.user(), u.passwordHash, nil
+}
+
+func (s *memoryStore) CreateSession(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	for hash, session := range s.sessions {
+		if session.userID == userID && !session.expiresAt.After(now) {
+			delete(s.sessions, hash)
+		}
+	}
+	s.sessions[tokenHash] = memorySession{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *memoryStore) SessionUser(ctx context.Context, tokenHash string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[tokenHash]
+	if !ok || !session.expiresAt.After(time.Now()) {
+		return User{}, ErrNotFound
+	}
+	return s.users[session.userID].user(), nil
+}
+
+func (s *memoryStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+func (s *memoryStore) ListUsers(ctx context.Context) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []User{}
+	for _, u := range s.users {
+		users = append(users, u.user())
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return strings.ToLower(users[i].Username) < strings.ToLower(users[j].Username)
+	})
+	return users, nil
+}
+
+func (s *memoryStore) GetUser(ctx context.Context, id int) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u.user(), nil
+}
+
+func (s *memoryStore) GrantRole(ctx context.Context, userID int, role string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	delete(u.oidcRoles, role)
+	for _, r := range u.Roles {
+		if r == role {
+			return u.user(), nil
+		}
+	}
+	u.Roles = append(append([]string{}, u.Roles...), role)
+	sortRoles(u.Roles)
+	s.users[userID] = u
+	return u.user(), nil
+}
+
+func (s *memoryStore) RevokeRole(ctx context.Context, userID int, role string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	roles := []string{}
+	for _, r := range u.Roles {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	if role == roleAdmin && len(roles) < len(u.Roles) && s.admins() == 1 {
+		return User{}, fmt.Errorf("%w: user %d is the last admin", ErrConflict, userID)
+	}
+	delete(u.oidcRoles, role)
+	u.Roles = roles
+	s.users[userID] = u
+	return u.user(), nil
+}
+
+func (s *memoryStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, k := range s.apiKeys {
+		keys = append(keys, k.apiKey())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID > keys[j].ID
+	})
+	return keys, nil
+}
+
+func (s *memoryStore) CreateAPIKey(ctx context.Context, key *APIKey, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.CreatedBy != nil {
+		if _, ok := s.users[*key.CreatedBy]; !ok {
+			return ErrNotFound
+		}
+	}
+	key.ID = s.nextID()
+	key.CreatedAt = time.Now()
+	stored := memoryAPIKey{APIKey: *key, hash: hash}
+	stored.Key = ""
+	stored.Scopes = append([]string{}, key.Scopes...)
+	s.apiKeys[key.ID] = stored
+	return nil
+}
+
+func (s *memoryStore) DeleteAPIKey(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiKeys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.apiKeys, id)
+	return nil
+}
+
+func (s *memoryStore) UseAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, k := range s.apiKeys {
+		if k.hash != hash {
+			continue
+		}
+		if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+			break
+		}
+		k.LastUsedAt = &now
+		s.apiKeys[id] = k
+		return k.apiKey(), nil
+	}
+	return APIKey{}, ErrNotFound
+}
@@ -0,0 +1,2434 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// postgresStore is the Store backed by a PostgreSQL database.
+type postgresStore struct {
+	db *sql.DB
+}
+
+// openPostgres connects to the database and verifies it is reachable.
+func openPostgres(connStr string) (*sql.DB, error) {
+	log.Println("Connecting to database...")
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Pinging database...")
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// newPostgresStore connects to the database and refuses to continue unless
+// its schema matches the migrations embedded in this binary.
+func newPostgresStore(connStr string) (*postgresStore, error) {
+	db, err := openPostgres(connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Checking schema version...")
+	m, err := newMigrator(db)
+	if err == nil {
+		err = m.Check(context.Background())
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	log.Println("Database initialization complete")
+	return &postgresStore{db: db}, nil
+}
+
+func (s *postgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+const movieColumns = `m.id, m.mid, m.title, m.cover, COALESCE(m.year, 0),
+	COALESCE(to_char(m.release_date, 'YYYY-MM-DD'), ''), COALESCE(m.runtime, 0), m.synopsis,
+	COALESCE(m.original_language, ''), m.countries, COALESCE(m.content_rating, ''),
+	m.created_at, d.id, d.firstname, d.lastname`
+
+// movieDest returns the scan destinations for movieColumns.
+func movieDest(m *Movie) []interface{} {
+	return []interface{}{&m.ID, &m.MID, &m.Title, &m.Cover, &m.Year,
+		&m.ReleaseDate, &m.Runtime, &m.Synopsis,
+		&m.OriginalLanguage, pq.Array(&m.Countries), &m.ContentRating,
+		&m.CreatedAt, &m.Director.ID, &m.Director.Firstname, &m.Director.Lastname}
+}
+
+func scanMovie(rows *sql.Rows) (Movie, error) {
+	var m Movie
+	err := rows.Scan(movieDest(&m)...)
+	return m, err
+}
+
+// queryMovies runs a query selecting movieColumns and scans every row.
+func queryMovies(ctx context.Context, q queryer, query string, args ...interface{}) ([]Movie, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []Movie
+	for rows.Next() {
+		m, err := scanMovie(rows)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, m)
+	}
+	return movies, rows.Err()
+}
+
+// attachCategories loads the categories of every movie in one query and
+// assigns them in place.
+func attachCategories(ctx context.Context, q queryer, movies []Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(movies))
+	index := make(map[string][]int, len(movies))
+	for i, m := range movies {
+		ids[i] = m.ID
+		index[m.ID] = append(index[m.ID], i)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT mc.movie_id, `+categoryColumns+`
+		FROM categories c
+		JOIN movie_categories mc ON c.id = mc.category_id
+		WHERE mc.movie_id = ANY($1::int[])
+		ORDER BY c.name`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID string
+		var c categoryRow
+		if err := rows.Scan(append([]interface{}{&movieID}, c.dest()...)...); err != nil {
+			return err
+		}
+		for _, i := range index[movieID] {
+			movies[i].Categories = append(movies[i].Categories, c.category())
+		}
+	}
+	return rows.Err()
+}
+
+// attachTags loads the tags of every movie in one query and assigns them
+// in place.
+func attachTags(ctx context.Context, q queryer, movies []Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(movies))
+	index := make(map[string][]int, len(movies))
+	for i, m := range movies {
+		ids[i] = m.ID
+		index[m.ID] = append(index[m.ID], i)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT mt.movie_id, t.name
+		FROM tags t
+		JOIN movie_tags mt ON t.id = mt.tag_id
+		WHERE mt.movie_id = ANY($1::int[])
+		ORDER BY lower(t.name)`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID, name string
+		if err := rows.Scan(&movieID, &name); err != nil {
+			return err
+		}
+		for _, i := range index[movieID] {
+			movies[i].Tags = append(movies[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// attachCredits loads the credits of every movie in one query and assigns
+// them in place, in the order they were given.
+func attachCredits(ctx context.Context, q queryer, movies []Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(movies))
+	index := make(map[string][]int, len(movies))
+	for i, m := range movies {
+		ids[i] = m.ID
+		index[m.ID] = append(index[m.ID], i)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT mc.movie_id, p.id, p.firstname, p.lastname, mc.role
+		FROM movie_credits mc
+		JOIN people p ON p.id = mc.person_id
+		WHERE mc.movie_id = ANY($1::int[])
+		ORDER BY mc.position`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID string
+		var c Credit
+		if err := rows.Scan(&movieID, &c.PersonID, &c.Firstname, &c.Lastname, &c.Role); err != nil {
+			return err
+		}
+		for _, i := range index[movieID] {
+			movies[i].Credits = append(movies[i].Credits, c)
+		}
+	}
+	return rows.Err()
+}
+
+// attachCast loads the cast of every movie in one query and assigns it in
+// place, in billing order.
+func attachCast(ctx context.Context, q queryer, movies []Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(movies))
+	index := make(map[string][]int, len(movies))
+	for i, m := range movies {
+		ids[i] = m.ID
+		index[m.ID] = append(index[m.ID], i)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT mc.movie_id, p.id, p.firstname, p.lastname, mc.character, mc.billing
+		FROM movie_cast mc
+		JOIN people p ON p.id = mc.person_id
+		WHERE mc.movie_id = ANY($1::int[])
+		ORDER BY mc.billing`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID string
+		var c CastMember
+		if err := rows.Scan(&movieID, &c.PersonID, &c.Firstname, &c.Lastname, &c.Character, &c.Billing); err != nil {
+			return err
+		}
+		for _, i := range index[movieID] {
+			movies[i].Cast = append(movies[i].Cast, c)
+		}
+	}
+	return rows.Err()
+}
+
+// queryMoviesWithDetails is queryMovies followed by attachCategories,
+// attachTags, attachCredits and attachCast, costing five round trips
+// regardless of the number of movies.
+func queryMoviesWithDetails(ctx context.Context, q queryer, query string, args ...interface{}) ([]Movie, error) {
+	movies, err := queryMovies(ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachCategories(ctx, q, movies); err != nil {
+		return nil, err
+	}
+	if err := attachTags(ctx, q, movies); err != nil {
+		return nil, err
+	}
+	if err := attachCredits(ctx, q, movies); err != nil {
+		return nil, err
+	}
+	if err := attachCast(ctx, q, movies); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// whereBuilder accumulates AND-ed conditions and their numbered arguments.
+type whereBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg records v and returns its placeholder.
+func (b *whereBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *whereBuilder) and(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+func (b *whereBuilder) String() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// addFilters appends the conditions for the filter fields of opts.
+func (b *whereBuilder) addFilters(opts ListOptions) {
+	if opts.Category != "" {
+		categories := "SELECT c.id FROM categories c WHERE "
+		if id, err := strconv.Atoi(opts.Category); err == nil {
+			categories += "c.id = " + b.arg(id)
+		} else {
+			categories += "lower(c.name) = lower(" + b.arg(opts.Category) + ")"
+		}
+		if opts.Subcategories {
+			categories = categorySubtree(categories)
+		}
+		b.and(`EXISTS (SELECT 1 FROM movie_categories fc
+			WHERE fc.movie_id = m.id AND fc.category_id IN (` + categories + `))`)
+	}
+	if opts.PersonID != 0 {
+		b.and(`EXISTS (SELECT 1 FROM movie_people fp
+			WHERE fp.movie_id = m.id AND fp.person_id = ` + b.arg(opts.PersonID) + `)`)
+	}
+	if opts.DirectorID != 0 {
+		b.and(`EXISTS (SELECT 1 FROM movie_credits fd
+			WHERE fd.movie_id = m.id AND fd.person_id = ` + b.arg(opts.DirectorID) + ` AND fd.role = 'director')`)
+	}
+	if opts.YearFrom != 0 {
+		b.and("m.year >= " + b.arg(opts.YearFrom))
+	}
+	if opts.YearTo != 0 {
+		b.and("m.year <= " + b.arg(opts.YearTo))
+	}
+	if opts.RuntimeMin != 0 {
+		b.and("m.runtime >= " + b.arg(opts.RuntimeMin))
+	}
+	if opts.RuntimeMax != 0 {
+		b.and("m.runtime <= " + b.arg(opts.RuntimeMax))
+	}
+	if opts.Language != "" {
+		b.and("m.original_language = " + b.arg(opts.Language))
+	}
+	if opts.Country != "" {
+		b.and("m.countries @> ARRAY[" + b.arg(opts.Country) + "]::text[]")
+	}
+	if opts.ContentRating != "" {
+		b.and("m.content_rating = " + b.arg(opts.ContentRating))
+	}
+	for _, tag := range opts.Tags {
+		b.and(`EXISTS (SELECT 1 FROM movie_tags ft
+			JOIN tags t ON t.id = ft.tag_id
+			WHERE ft.movie_id = m.id AND lower(t.name) = lower(` + b.arg(tag) + `))`)
+	}
+	if opts.HasCover != nil {
+		if *opts.HasCover {
+			b.and("COALESCE(m.cover, '') <> ''")
+		} else {
+			b.and("COALESCE(m.cover, '') = ''")
+		}
+	}
+}
+
+// movieSource is what a listing selects from: a FROM clause binding the
+// aliases m and d, and the SQL expression reported as Movie.Rank.
+type movieSource struct {
+	from string
+	rank string
+}
+
+var allMovies = movieSource{
+	from: `
+		FROM movies m
+		JOIN people d ON m.director_id = d.id `,
+	rank: "0",
+}
+
+// findMovies pages through the movies of src that match where, counting
+// the total matches and ordering by opts.Sort with m.id as the tie breaker.
+func findMovies(ctx context.Context, q queryer, src movieSource, where *whereBuilder, opts ListOptions) (MoviePage, error) {
+	var page MoviePage
+	where.addFilters(opts)
+
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) "+src.from+where.String(), where.args...).Scan(&page.Total)
+	if err != nil {
+		return page, err
+	}
+	if len(opts.Facets) > 0 {
+		page.Facets, err = queryFacets(ctx, q, src.from+where.String(), where.args, opts.Facets)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	sort := movieSorts[opts.Sort]
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	var order, keyExprs, keyParams []string
+	for _, col := range sort.columns {
+		order = append(order, col.expr+" "+dir)
+		keyExprs = append(keyExprs, col.expr)
+	}
+	order = append(order, "m.id "+dir)
+	keyExprs = append(keyExprs, "m.id")
+
+	if opts.After != nil {
+		for i, col := range sort.columns {
+			p := where.arg(opts.After.Key[i])
+			if col.param != "" {
+				p = fmt.Sprintf(col.param, p)
+			}
+			keyParams = append(keyParams, p)
+		}
+		keyParams = append(keyParams, where.arg(opts.After.ID))
+		where.and("(" + strings.Join(keyExprs, ", ") + ") " + cmp + " (" + strings.Join(keyParams, ", ") + ")")
+	}
+
+	query := "SELECT " + movieColumns + ", " + src.rank + src.from + where.String() + " ORDER BY " + strings.Join(order, ", ")
+	if opts.Limit > 0 {
+		// Fetch one extra row to learn whether another page follows.
+		query += " LIMIT " + where.arg(opts.Limit+1)
+	}
+	if opts.Offset > 0 {
+		query += " OFFSET " + where.arg(opts.Offset)
+	}
+
+	rows, err := q.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Movie
+		if err := rows.Scan(append(movieDest(&m), &m.Rank)...); err != nil {
+			return page, err
+		}
+		page.Movies = append(page.Movies, m)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if err := attachCategories(ctx, q, page.Movies); err != nil {
+		return page, err
+	}
+	if err := attachTags(ctx, q, page.Movies); err != nil {
+		return page, err
+	}
+	if err := attachCredits(ctx, q, page.Movies); err != nil {
+		return page, err
+	}
+	if err := attachCast(ctx, q, page.Movies); err != nil {
+		return page, err
+	}
+	if opts.Limit > 0 && len(page.Movies) > opts.Limit {
+		page.Movies = page.Movies[:opts.Limit]
+		page.NextCursor = newMovieCursor(opts, page.Movies[opts.Limit-1])
+	}
+	return page, nil
+}
+
+// facetQueries aggregate one facet over the movies selected by a FROM and
+// WHERE clause, which %s stands for. Each returns value, label and count.
+var facetQueries = map[string]string{
+	"category": `
+		SELECT c.id::text, c.name, COUNT(*)
+		FROM (SELECT m.id %s) f
+		JOIN movie_categories mc ON mc.movie_id = f.id
+		JOIN categories c ON c.id = mc.category_id
+		GROUP BY c.id
+		ORDER BY COUNT(*) DESC, c.name
+		LIMIT ` + strconv.Itoa(maxFacetValues),
+	"director": `
+		SELECT p.id::text, p.firstname || ' ' || p.lastname, COUNT(*)
+		FROM (SELECT m.id %s) f
+		JOIN movie_credits mc ON mc.movie_id = f.id AND mc.role = 'director'
+		JOIN people p ON p.id = mc.person_id
+		GROUP BY p.id
+		ORDER BY COUNT(*) DESC, 2
+		LIMIT ` + strconv.Itoa(maxFacetValues),
+	"decade": `
+		SELECT f.decade::text, f.decade || 's', COUNT(*)
+		FROM (SELECT m.year / 10 * 10 AS decade %s) f
+		WHERE f.decade IS NOT NULL
+		GROUP BY f.decade
+		ORDER BY f.decade`,
+}
+
+// queryFacets counts the requested facets over the movies that filtered, a
+// FROM and WHERE clause taking args, selects.
+func queryFacets(ctx context.Context, q queryer, filtered string, args []interface{}, kinds []string) (Facets, error) {
+	facets := make(Facets)
+	for _, kind := range kinds {
+		rows, err := q.QueryContext(ctx, fmt.Sprintf(facetQueries[kind], filtered), args...)
+		if err != nil {
+			return nil, err
+		}
+		values := []FacetValue{}
+		for rows.Next() {
+			var fv FacetValue
+			if err := rows.Scan(&fv.Value, &fv.Label, &fv.Count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			values = append(values, fv)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		facets[kind] = values
+	}
+	return facets, nil
+}
+
+func (s *postgresStore) ListMovies(ctx context.Context, opts ListOptions) (MoviePage, error) {
+	return findMovies(ctx, s.db, allMovies, &whereBuilder{}, opts)
+}
+
+func (s *postgresStore) GetMovie(ctx context.Context, id int) (Movie, error) {
+	movies, err := queryMoviesWithDetails(ctx, s.db, `
+		SELECT `+movieColumns+`
+		FROM movies m
+		JOIN people d ON m.director_id = d.id
+		WHERE m.id = $1`, id)
+	if err != nil {
+		return Movie{}, err
+	}
+	if len(movies) == 0 {
+		return Movie{}, ErrNotFound
+	}
+	err = attachLinks(ctx, s.db, &movies[0])
+	return movies[0], err
+}
+
+func (s *postgresStore) GetMovieByMID(ctx context.Context, mid string) (Movie, error) {
+	movies, err := queryMoviesWithDetails(ctx, s.db, `
+		SELECT `+movieColumns+`
+		FROM movies m
+		JOIN people d ON m.director_id = d.id
+		WHERE m.mid = $1`, mid)
+	if err != nil {
+		return Movie{}, err
+	}
+	if len(movies) == 0 {
+		return Movie{}, ErrNotFound
+	}
+	err = attachLinks(ctx, s.db, &movies[0])
+	return movies[0], err
+}
+
+// directorName is the director name expression covered by the trigram index.
+const directorName = "(dv.firstname || ' ' || dv.lastname)"
+
+// fuzzyRankWeight scales a fuzzy match's similarity into the range of
+// ts_rank scores, so exact matches outrank near misses.
+const fuzzyRankWeight = 0.5
+
+func (s *postgresStore) SearchMovies(ctx context.Context, sq SearchQuery, opts ListOptions) (MoviePage, error) {
+	where := &whereBuilder{}
+
+	// Free text must match the title, the director, a category, a tag or
+	// another credited person. Each
+	// check stays on a single indexed vector so the GIN indexes serve it.
+	var text, filters []string
+	for _, c := range sq.Clauses {
+		cond := "(" + where.compileClause(c) + ")"
+		if c.negated() {
+			filters = append(filters, cond+" IS NOT TRUE")
+		} else if _, ok := c.(*textClause); ok {
+			text = append(text, cond)
+		} else {
+			filters = append(filters, cond)
+		}
+	}
+
+	rank := "0"
+	if terms := sq.textTerms(); len(terms) > 0 {
+		rank = "ts_rank(mv.search_vector || dv.search_vector || COALESCE(cv.vector, ''::tsvector) || COALESCE(pv.vector, ''::tsvector), " +
+			"to_tsquery('english', " + where.arg(allTermsTSQuery(terms)) + "))"
+
+		// Near misses on the title or director name also satisfy the free
+		// text. <% compares against pg_trgm.word_similarity_threshold, set
+		// for this transaction.
+		if sq.Similarity > 0 {
+			fuzzy := where.arg(sq.fuzzyText())
+			text = []string{"((" + strings.Join(text, " AND ") + ") OR " +
+				fuzzy + " <% mv.title OR " + fuzzy + " <% " + directorName + ")"}
+			rank += fmt.Sprintf(" + %g * GREATEST(word_similarity(%s, mv.title), word_similarity(%s, %s))",
+				fuzzyRankWeight, fuzzy, fuzzy, directorName)
+		}
+	}
+	cond := strings.Join(append(text, filters...), " AND ")
+
+	ranked := movieSource{rank: "m.rank", from: `
+		FROM (
+			SELECT mv.*, ` + rank + ` AS rank
+			FROM movies mv
+			JOIN people dv ON dv.id = mv.director_id
+			LEFT JOIN LATERAL (
+				SELECT setweight(to_tsvector('english', string_agg(label, ' ')), 'C') AS vector
+				FROM (
+					SELECT c.name AS label FROM movie_categories mc
+					JOIN categories c ON c.id = mc.category_id
+					WHERE mc.movie_id = mv.id
+					UNION ALL
+					SELECT t.name FROM movie_tags mt
+					JOIN tags t ON t.id = mt.tag_id
+					WHERE mt.movie_id = mv.id
+				) labels
+			) cv ON true
+			LEFT JOIN LATERAL (
+				SELECT setweight(to_tsvector('english', string_agg(p.firstname || ' ' || p.lastname, ' ')), 'D') AS vector
+				FROM movie_people mp
+				JOIN people p ON p.id = mp.person_id
+				WHERE mp.movie_id = mv.id
+			) pv ON true
+			WHERE ` + cond + `
+		) m
+		JOIN people d ON m.director_id = d.id `}
+
+	var page MoviePage
+	err := s.withSimilarity(ctx, sq.Similarity, func(tx *sql.Tx) error {
+		var err error
+		if page, err = findMovies(ctx, tx, ranked, where, opts); err != nil {
+			return err
+		}
+		return attachSnippets(ctx, tx, page.Movies, sq.highlightTerms())
+	})
+	return page, err
+}
+
+// compileClause renders a search clause, ignoring its negation, as a
+// condition on the movie mv and its director dv. Terms made only of stop
+// words leave the query unconstrained whether negated or not.
+func (b *whereBuilder) compileClause(c searchClause) string {
+	match := func(t searchTerm, cond func(q string) string) string {
+		q := "to_tsquery('english', " + b.arg(t.tsquery()) + ")"
+		if c.negated() {
+			return "numnode(" + q + ") > 0 AND (" + cond(q) + ")"
+		}
+		return "numnode(" + q + ") = 0 OR " + cond(q)
+	}
+	switch c := c.(type) {
+	case *textClause:
+		return match(c.Term, func(q string) string {
+			return `mv.search_vector @@ ` + q + `
+				OR dv.search_vector @@ ` + q + `
+				OR EXISTS (SELECT 1 FROM movie_categories smc
+					JOIN categories sc ON sc.id = smc.category_id
+					WHERE smc.movie_id = mv.id AND sc.search_vector @@ ` + q + `)
+				OR EXISTS (SELECT 1 FROM movie_tags smt
+					JOIN tags st ON st.id = smt.tag_id
+					WHERE smt.movie_id = mv.id AND st.search_vector @@ ` + q + `)
+				OR EXISTS (SELECT 1 FROM movie_people smp
+					JOIN people sp ON sp.id = smp.person_id
+					WHERE smp.movie_id = mv.id AND sp.search_vector @@ ` + q + `)`
+		})
+	case *fieldClause:
+		switch c.Field {
+		case "director":
+			return match(c.Term, func(q string) string { return "dv.search_vector @@ " + q })
+		case "actor":
+			return match(c.Term, func(q string) string {
+				return `EXISTS (SELECT 1 FROM movie_cast smc
+					JOIN people sp ON sp.id = smc.person_id
+					WHERE smc.movie_id = mv.id AND sp.search_vector @@ ` + q + `)`
+			})
+		}
+		return match(c.Term, func(q string) string { return "mv.search_vector @@ " + q })
+	case *categoryClause:
+		match := "lower(sc.name) = lower(" + b.arg(c.Name) + ")"
+		if c.Prefix {
+			match = "starts_with(lower(sc.name), lower(" + b.arg(c.Name) + "))"
+		}
+		return `EXISTS (SELECT 1 FROM movie_categories smc
+			JOIN categories sc ON sc.id = smc.category_id
+			WHERE smc.movie_id = mv.id AND ` + match + `)`
+	case *tagClause:
+		match := "lower(st.name) = lower(" + b.arg(c.Name) + ")"
+		if c.Prefix {
+			match = "starts_with(lower(st.name), lower(" + b.arg(c.Name) + "))"
+		}
+		return `EXISTS (SELECT 1 FROM movie_tags smt
+			JOIN tags st ON st.id = smt.tag_id
+			WHERE smt.movie_id = mv.id AND ` + match + `)`
+	case *yearClause:
+		if c.Op == ".." {
+			return "mv.year BETWEEN " + b.arg(c.Year) + " AND " + b.arg(c.To)
+		}
+		return "mv.year " + c.Op + " " + b.arg(c.Year)
+	}
+	panic(fmt.Sprintf("unknown search clause %T", c))
+}
+
+// withSimilarity runs fn in a transaction whose pg_trgm word similarity
+// threshold is set to similarity, so the indexed <% operator applies it.
+func (s *postgresStore) withSimilarity(ctx context.Context, similarity float64, fn func(tx *sql.Tx) error) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if similarity > 0 {
+			_, err := tx.ExecContext(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)",
+				strconv.FormatFloat(similarity, 'f', -1, 64))
+			if err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func (s *postgresStore) SuggestQueries(ctx context.Context, text string, similarity float64, limit int) ([]string, error) {
+	var suggestions []string
+	err := s.withSimilarity(ctx, similarity, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT name
+			FROM (
+				SELECT title AS name, word_similarity($1, title) AS score
+				FROM movies WHERE $1 <% title
+				UNION ALL
+				SELECT dv.firstname || ' ' || dv.lastname, word_similarity($1, `+directorName+`)
+				FROM people dv WHERE $1 <% `+directorName+`
+				UNION ALL
+				SELECT name, word_similarity($1, name)
+				FROM categories WHERE $1 <% name
+			) candidates
+			GROUP BY name
+			ORDER BY MAX(score) DESC, name
+			LIMIT $2`, text, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			suggestions = append(suggestions, name)
+		}
+		return rows.Err()
+	})
+	return suggestions, err
+}
+
+// attachSnippets sets Snippet on each movie to its title, director and
+// categories with the matched words wrapped in <mark> tags. It runs on one
+// page of results only, since ts_headline is comparatively expensive.
+func attachSnippets(ctx context.Context, q queryer, movies []Movie, terms []searchTerm) error {
+	if len(movies) == 0 {
+		return nil
+	}
+	ids := make([]string, len(movies))
+	index := make(map[string]int, len(movies))
+	for i, m := range movies {
+		ids[i] = m.ID
+		index[m.ID] = i
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT m.id, ts_headline('english',
+			concat_ws(' · ', m.title, d.firstname || ' ' || d.lastname,
+				(SELECT string_agg(c.name, ', ' ORDER BY c.name)
+				FROM movie_categories mc
+				JOIN categories c ON c.id = mc.category_id
+				WHERE mc.movie_id = m.id)),
+			to_tsquery('english', $2),
+			'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')
+		FROM movies m
+		JOIN people d ON d.id = m.director_id
+		WHERE m.id = ANY($1::int[])`, pq.Array(ids), anyTermTSQuery(terms))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, snippet string
+		if err := rows.Scan(&id, &snippet); err != nil {
+			return err
+		}
+		movies[index[id]].Snippet = snippet
+	}
+	return rows.Err()
+}
+
+// addRules appends the conditions of a smart category's rules.
+func (b *whereBuilder) addRules(r CategoryRules) {
+	b.addFilters(r.filters())
+	for _, id := range r.Categories {
+		b.and(`EXISTS (SELECT 1 FROM movie_categories rc
+			WHERE rc.movie_id = m.id AND rc.category_id IN (` + categorySubtree("SELECT "+b.arg(id)+"::int") + `))`)
+	}
+	for _, id := range r.ExcludeCategories {
+		b.and(`NOT EXISTS (SELECT 1 FROM movie_categories rc
+			WHERE rc.movie_id = m.id AND rc.category_id IN (` + categorySubtree("SELECT "+b.arg(id)+"::int") + `))`)
+	}
+}
+
+// countSmartMovies counts the movies of each smart category, given by id
+// with its rules, in a single query.
+func countSmartMovies(ctx context.Context, q queryer, rules map[int]CategoryRules) (map[int]int, error) {
+	counts := make(map[int]int, len(rules))
+	if len(rules) == 0 {
+		return counts, nil
+	}
+
+	query, args := smartCountQuery(rules)
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// smartCountQuery builds the query of countSmartMovies, which selects each
+// category id with its count. The counts share one argument list; only
+// their conditions differ.
+func smartCountQuery(rules map[int]CategoryRules) (string, []interface{}) {
+	where := &whereBuilder{}
+	var selects []string
+	for id, r := range rules {
+		where.conds = nil
+		where.addRules(r)
+		selects = append(selects, "SELECT "+where.arg(id)+"::int, COUNT(*) "+allMovies.from+where.String())
+	}
+	return strings.Join(selects, " UNION ALL "), where.args
+}
+
+// categoryRules returns the rules of category id, nil unless it is a
+// smart category.
+func categoryRules(ctx context.Context, q queryer, id int) (*CategoryRules, error) {
+	var rules *CategoryRules
+	err := q.QueryRowContext(ctx, "SELECT rules FROM categories WHERE id = $1", id).Scan(&rules)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return rules, err
+}
+
+// categorySubtree extends a query selecting category ids to also select
+// every descendant of those categories.
+func categorySubtree(roots string) string {
+	return `WITH RECURSIVE subtree(id) AS (
+			` + roots + `
+			UNION
+			SELECT sc.id FROM categories sc JOIN subtree st ON sc.parent_id = st.id
+		)
+		SELECT id FROM subtree`
+}
+
+func (s *postgresStore) MoviesByCategory(ctx context.Context, categoryID int, opts ListOptions) (MoviePage, error) {
+	where := &whereBuilder{}
+	rules, err := categoryRules(ctx, s.db, categoryID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return MoviePage{}, err
+	}
+	if rules != nil {
+		where.addRules(*rules)
+		return findMovies(ctx, s.db, allMovies, where, opts)
+	}
+
+	categories := "SELECT " + where.arg(categoryID) + "::int"
+	if opts.Subcategories {
+		categories = categorySubtree(categories)
+	}
+	where.and(`EXISTS (SELECT 1 FROM movie_categories mc
+		WHERE mc.movie_id = m.id AND mc.category_id IN (` + categories + `))`)
+	return findMovies(ctx, s.db, allMovies, where, opts)
+}
+
+// withTx runs fn inside a transaction, rolling back if fn fails.
+func (s *postgresStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// linkCategories attaches the named categories to a movie, creating any
+// category that does not exist yet.
+func linkCategories(ctx context.Context, tx *sql.Tx, movieID interface{}, categories []Category) error {
+	for _, category := range categories {
+		var categoryID int
+		var smart bool
+		err := tx.QueryRowContext(ctx, "SELECT id, rules IS NOT NULL FROM categories WHERE name = $1",
+			category.Name).Scan(&categoryID, &smart)
+		if smart {
+			return smartCategoryConflict(categoryID, "movies cannot be assigned to")
+		}
+		if err == sql.ErrNoRows {
+			err = tx.QueryRowContext(ctx, "INSERT INTO categories (name) VALUES ($1) RETURNING id", category.Name).Scan(&categoryID)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO movie_categories (movie_id, category_id) VALUES ($1, $2)", movieID, categoryID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTags replaces the tags of a movie, creating tags named for the first
+// time and deleting those no movie has any more. Names in tags are
+// respelled as stored.
+func setTags(ctx context.Context, tx *sql.Tx, movieID interface{}, tags []string) error {
+	var previous []int64
+	err := tx.QueryRowContext(ctx, "SELECT array_agg(tag_id) FROM movie_tags WHERE movie_id = $1",
+		movieID).Scan(pq.Array(&previous))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM movie_tags WHERE movie_id = $1", movieID); err != nil {
+		return err
+	}
+
+	for i, name := range tags {
+		// Names differing only in case share the tag first created, whose
+		// spelling the movie takes.
+		_, err := tx.ExecContext(ctx, "INSERT INTO tags (name) VALUES ($1) ON CONFLICT (lower(name)) DO NOTHING", name)
+		if err != nil {
+			return err
+		}
+		var tagID int
+		err = tx.QueryRowContext(ctx, "SELECT id, name FROM tags WHERE lower(name) = lower($1)", name).Scan(&tagID, &tags[i])
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO movie_tags (movie_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", movieID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM tags t
+		WHERE t.id = ANY($1::int[])
+			AND NOT EXISTS (SELECT 1 FROM movie_tags mt WHERE mt.tag_id = t.id)`, pq.Array(previous))
+	return err
+}
+
+// resolvePerson returns the id of the person with the given name,
+// creating them if there is none.
+func resolvePerson(ctx context.Context, tx *sql.Tx, firstname, lastname string) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx, "SELECT id FROM people WHERE firstname = $1 AND lastname = $2",
+		firstname, lastname).Scan(&id)
+	if err == sql.ErrNoRows {
+		//Person doesn't exist, create new
+		err = tx.QueryRowContext(ctx, "INSERT INTO people (firstname, lastname) VALUES ($1, $2) RETURNING id",
+			firstname, lastname).Scan(&id)
+	}
+	return id, err
+}
+
+// linkCredits credits people on a movie in the given order, resolving
+// each by name and setting Credit.PersonID.
+func linkCredits(ctx context.Context, tx *sql.Tx, movieID interface{}, credits []Credit) error {
+	for i := range credits {
+		c := &credits[i]
+		var err error
+		if c.PersonID, err = resolvePerson(ctx, tx, c.Firstname, c.Lastname); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO movie_credits (movie_id, person_id, role, position) VALUES ($1, $2, $3, $4)",
+			movieID, c.PersonID, c.Role, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkCast adds the cast of a movie, resolving each member by name and
+// setting CastMember.PersonID.
+func linkCast(ctx context.Context, tx *sql.Tx, movieID interface{}, cast []CastMember) error {
+	for i := range cast {
+		c := &cast[i]
+		var err error
+		if c.PersonID, err = resolvePerson(ctx, tx, c.Firstname, c.Lastname); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO movie_cast (movie_id, person_id, character, billing) VALUES ($1, $2, $3, $4)",
+			movieID, c.PersonID, c.Character, c.Billing)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moviePeople returns the ids of everyone credited or cast on a movie,
+// including its primary director.
+func moviePeople(ctx context.Context, tx *sql.Tx, movieID int) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT director_id FROM movies WHERE id = $1 AND director_id IS NOT NULL
+		UNION
+		SELECT person_id FROM movie_people WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// rulesNamingPerson is the condition on categories c of their rules
+// naming the person whose id is the expression person.
+func rulesNamingPerson(person string) string {
+	return "((c.rules->>'director_id')::int = " + person + " OR (c.rules->>'person_id')::int = " + person + ")"
+}
+
+// deleteOrphanPeople deletes those of the given people no movie credits or
+// casts any more, and no smart category's rules name.
+func deleteOrphanPeople(ctx context.Context, tx *sql.Tx, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM people p
+		WHERE p.id = ANY($1::int[])
+			AND NOT EXISTS (SELECT 1 FROM movies WHERE director_id = p.id)
+			AND NOT EXISTS (SELECT 1 FROM movie_people WHERE person_id = p.id)
+			AND NOT EXISTS (SELECT 1 FROM categories c WHERE `+rulesNamingPerson("p.id")+`)`, pq.Array(ids))
+	return err
+}
+
+func (s *postgresStore) CreateMovie(ctx context.Context, movie *Movie) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		directorID, err := resolvePerson(ctx, tx, movie.Director.Firstname, movie.Director.Lastname)
+		if err != nil {
+			return err
+		}
+		movie.Director.ID = directorID
+
+		// Try MIDs until one is free; the unique index settles races.
+		base := movie.MID
+		for n := 1; ; n++ {
+			movie.MID = midCandidate(base, n)
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO movies (mid, title, director_id, cover, year,
+					release_date, runtime, synopsis, original_language, countries, content_rating)
+				VALUES ($1, $2, $3, $4, NULLIF($5, 0),
+					NULLIF($6, '')::date, NULLIF($7, 0), $8, NULLIF($9, ''), $10, NULLIF($11, ''))
+				ON CONFLICT (mid) DO NOTHING
+				RETURNING id, created_at`,
+				movie.MID, movie.Title, directorID, movie.Cover, movie.Year,
+				movie.ReleaseDate, movie.Runtime, movie.Synopsis, movie.OriginalLanguage,
+				pq.Array(movie.Countries), movie.ContentRating).Scan(&movie.ID, &movie.CreatedAt)
+			if err != sql.ErrNoRows {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := linkCredits(ctx, tx, movie.ID, movie.Credits); err != nil {
+			return err
+		}
+		if err := linkCast(ctx, tx, movie.ID, movie.Cast); err != nil {
+			return err
+		}
+		if err := setTags(ctx, tx, movie.ID, movie.Tags); err != nil {
+			return err
+		}
+		return linkCategories(ctx, tx, movie.ID, movie.Categories)
+	})
+}
+
+func (s *postgresStore) UpdateMovie(ctx context.Context, id int, movie *Movie) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT 1 FROM movies WHERE id = $1 FOR UPDATE", id).Scan(new(int))
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		previous, err := moviePeople(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		// People are matched by name like on create; renaming a director
+		// for every movie is UpdateDirector's job.
+		if movie.Director.ID, err = resolvePerson(ctx, tx, movie.Director.Firstname, movie.Director.Lastname); err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			UPDATE movies SET title = $1, cover = $2, year = NULLIF($3, 0), director_id = $4,
+				release_date = NULLIF($5, '')::date, runtime = NULLIF($6, 0), synopsis = $7,
+				original_language = NULLIF($8, ''), countries = $9, content_rating = NULLIF($10, '')
+			WHERE id = $11
+			RETURNING mid, created_at`,
+			movie.Title, movie.Cover, movie.Year, movie.Director.ID,
+			movie.ReleaseDate, movie.Runtime, movie.Synopsis, movie.OriginalLanguage,
+			pq.Array(movie.Countries), movie.ContentRating, id).Scan(&movie.MID, &movie.CreatedAt)
+		if err != nil {
+			return err
+		}
+		movie.ID = strconv.Itoa(id)
+
+		// Replace existing credits, cast and category associations
+		if _, err = tx.ExecContext(ctx, "DELETE FROM movie_credits WHERE movie_id = $1", id); err != nil {
+			return err
+		}
+		if err := linkCredits(ctx, tx, id, movie.Credits); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM movie_cast WHERE movie_id = $1", id); err != nil {
+			return err
+		}
+		if err := linkCast(ctx, tx, id, movie.Cast); err != nil {
+			return err
+		}
+		if err := deleteOrphanPeople(ctx, tx, previous); err != nil {
+			return err
+		}
+		if err := setTags(ctx, tx, id, movie.Tags); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM movie_categories WHERE movie_id = $1", id); err != nil {
+			return err
+		}
+		return linkCategories(ctx, tx, id, movie.Categories)
+	})
+}
+
+func (s *postgresStore) DeleteMovie(ctx context.Context, id int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		people, err := moviePeople(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		//Delete associated credits, cast, tags and categories first
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_credits WHERE movie_id = $1", id); err != nil {
+			return err
+		}
+		if err := setTags(ctx, tx, id, nil); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_cast WHERE movie_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_categories WHERE movie_id = $1", id); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM movies WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+
+		//Delete the people no other movies credit
+		return deleteOrphanPeople(ctx, tx, people)
+	})
+}
+
+// isUniqueViolation reports whether err is PostgreSQL rejecting a
+// duplicate key.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is PostgreSQL rejecting a
+// reference to a missing row.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// nullableID converts a nullable id column to a pointer.
+func nullableID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	v := int(id.Int64)
+	return &v
+}
+
+const categoryColumns = `c.id, c.name, c.parent_id, c.description, COALESCE(c.color, ''), c.icon, c.sort_order, c.rules`
+
+// categoryRow is the scan target for categoryColumns.
+type categoryRow struct {
+	Category
+	parentID sql.NullInt64
+}
+
+func (c *categoryRow) dest() []interface{} {
+	return []interface{}{&c.ID, &c.Name, &c.parentID, &c.Description, &c.Color, &c.Icon, &c.SortOrder, &c.Rules}
+}
+
+// category returns the scanned category.
+func (c *categoryRow) category() Category {
+	c.ParentID = nullableID(c.parentID)
+	return c.Category
+}
+
+func (s *postgresStore) ListDirectors(ctx context.Context) ([]Director, error) {
+	// People credited only in other roles are not directors; people not
+	// credited at all were created through /directors.
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.firstname, p.lastname
+		FROM people p
+		WHERE EXISTS (SELECT 1 FROM movie_credits mc WHERE mc.person_id = p.id AND mc.role = 'director')
+			OR NOT EXISTS (SELECT 1 FROM movie_people mp WHERE mp.person_id = p.id)
+		ORDER BY p.lastname, p.firstname, p.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var directors []Director
+	for rows.Next() {
+		var d Director
+		if err := rows.Scan(&d.ID, &d.Firstname, &d.Lastname); err != nil {
+			return nil, err
+		}
+		directors = append(directors, d)
+	}
+	return directors, rows.Err()
+}
+
+func (s *postgresStore) GetDirector(ctx context.Context, id int) (Director, error) {
+	d := Director{ID: id}
+	err := s.db.QueryRowContext(ctx, "SELECT firstname, lastname FROM people WHERE id = $1", id).Scan(&d.Firstname, &d.Lastname)
+	if err == sql.ErrNoRows {
+		return d, ErrNotFound
+	}
+	return d, err
+}
+
+func (s *postgresStore) CreateDirector(ctx context.Context, director *Director) error {
+	err := s.db.QueryRowContext(ctx, "INSERT INTO people (firstname, lastname) VALUES ($1, $2) RETURNING id",
+		director.Firstname, director.Lastname).Scan(&director.ID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: director %s %s already exists", ErrConflict, director.Firstname, director.Lastname)
+	}
+	return err
+}
+
+func (s *postgresStore) UpdateDirector(ctx context.Context, id int, director *Director) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE people SET firstname = $1, lastname = $2 WHERE id = $3",
+		director.Firstname, director.Lastname, id)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: director %s %s already exists", ErrConflict, director.Firstname, director.Lastname)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	director.ID = id
+	return nil
+}
+
+func (s *postgresStore) DeleteDirector(ctx context.Context, id int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var movies int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM movies m
+			WHERE m.director_id = $1
+				OR EXISTS (SELECT 1 FROM movie_people mp WHERE mp.movie_id = m.id AND mp.person_id = $1)`,
+			id).Scan(&movies)
+		if err != nil {
+			return err
+		}
+		if movies > 0 {
+			return fmt.Errorf("%w: director %d is credited on %d movies", ErrConflict, id, movies)
+		}
+		var smartID int
+		err = tx.QueryRowContext(ctx, "SELECT c.id FROM categories c WHERE "+rulesNamingPerson("$1::int")+" ORDER BY c.id LIMIT 1",
+			id).Scan(&smartID)
+		if err == nil {
+			return fmt.Errorf("%w: director %d is named in the rules of smart category %d", ErrConflict, id, smartID)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM people WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *postgresStore) MergeDirectors(ctx context.Context, id, intoID int) (Director, error) {
+	into := Director{ID: intoID}
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT firstname, lastname FROM people WHERE id = $1 FOR UPDATE",
+			intoID).Scan(&into.Firstname, &into.Lastname)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE movies SET director_id = $1 WHERE director_id = $2", intoID, id); err != nil {
+			return err
+		}
+		// Credits the target already holds in the same role are dropped.
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO movie_credits (movie_id, person_id, role, position)
+			SELECT movie_id, $1, role, position FROM movie_credits WHERE person_id = $2
+			ON CONFLICT DO NOTHING`, intoID, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_credits WHERE person_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE movie_cast SET person_id = $1 WHERE person_id = $2", intoID, id); err != nil {
+			return err
+		}
+		for _, rule := range []string{"director_id", "person_id"} {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE categories SET rules = jsonb_set(rules, '{`+rule+`}', to_jsonb($1::int))
+				WHERE (rules->>'`+rule+`')::int = $2`, intoID, id)
+			if err != nil {
+				return err
+			}
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM people WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return into, err
+}
+
+// liveCategories extends a query selecting category ids to also select
+// the ancestors of those categories.
+func liveCategories(roots string) string {
+	return `WITH RECURSIVE live(id) AS (
+			` + roots + `
+			UNION
+			SELECT c.parent_id FROM categories c JOIN live l ON c.id = l.id
+			WHERE c.parent_id IS NOT NULL
+		)
+		SELECT id FROM live`
+}
+
+// usedCategories selects the ids of the categories with movies.
+const usedCategories = `SELECT category_id FROM movie_categories`
+
+// ruleCategories selects the ids of the categories smart categories'
+// rules name.
+const ruleCategories = `
+	SELECT jsonb_array_elements_text(rules->'categories')::int FROM categories WHERE rules IS NOT NULL
+	UNION
+	SELECT jsonb_array_elements_text(rules->'exclude_categories')::int FROM categories WHERE rules IS NOT NULL`
+
+// rulesNaming returns, by id, the smart categories whose rules name
+// category id.
+func rulesNaming(ctx context.Context, q queryer, id int) ([]Category, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories c
+		WHERE c.rules->'categories' @> jsonb_build_array($1::int)
+			OR c.rules->'exclude_categories' @> jsonb_build_array($1::int)
+		ORDER BY c.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var smart []Category
+	for rows.Next() {
+		var c categoryRow
+		if err := rows.Scan(c.dest()...); err != nil {
+			return nil, err
+		}
+		smart = append(smart, c.category())
+	}
+	return smart, rows.Err()
+}
+
+func (s *postgresStore) ListCategories(ctx context.Context, includeEmpty bool) ([]Category, error) {
+	where := ""
+	if !includeEmpty {
+		where = "WHERE c.id IN (" + liveCategories(usedCategories) + ") OR c.rules IS NOT NULL"
+	}
+	// Smart categories are listed even when empty; their count follows.
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+categoryColumns+`,
+			(SELECT COUNT(*) FROM movie_categories mc WHERE mc.category_id = c.id)
+		FROM categories c
+		`+where+`
+		ORDER BY c.sort_order, c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var c categoryRow
+		var movies int
+		if err := rows.Scan(append(c.dest(), &movies)...); err != nil {
+			return nil, err
+		}
+		category := c.category()
+		category.MovieCount = &movies
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rules := make(map[int]CategoryRules)
+	for _, c := range categories {
+		if c.Rules != nil {
+			rules[c.ID] = *c.Rules
+		}
+	}
+	counts, err := countSmartMovies(ctx, s.db, rules)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range categories {
+		if c.Rules != nil {
+			*categories[i].MovieCount = counts[c.ID]
+		}
+	}
+	return categories, nil
+}
+
+func (s *postgresStore) GetCategory(ctx context.Context, id int) (Category, error) {
+	var c categoryRow
+	err := s.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.id = $1", id).Scan(c.dest()...)
+	if err == sql.ErrNoRows {
+		return Category{}, ErrNotFound
+	}
+	if err != nil {
+		return Category{}, err
+	}
+	return c.category(), nil
+}
+
+// categoryNameConflict returns the conflict of a category with a name
+// that is already taken.
+func categoryNameConflict(ctx context.Context, q queryer, name string) error {
+	var id int
+	if err := q.QueryRowContext(ctx, "SELECT id FROM categories WHERE name = $1", name).Scan(&id); err != nil {
+		return err
+	}
+	return categoryNameTaken(name, id)
+}
+
+// lockCategories keeps other transactions from changing the category tree
+// until tx ends, so that concurrent moves cannot form a cycle.
+func lockCategories(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE")
+	return err
+}
+
+func (s *postgresStore) CreateCategory(ctx context.Context, category *Category) error {
+	if category.ParentID != nil {
+		rules, err := categoryRules(ctx, s.db, *category.ParentID)
+		if err != nil {
+			return err
+		}
+		if rules != nil {
+			return smartCategoryConflict(*category.ParentID, "cannot have a parent or children")
+		}
+	}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO categories (name, parent_id, description, color, icon, sort_order, rules)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+		RETURNING id`,
+		category.Name, category.ParentID, category.Description, category.Color, category.Icon, category.SortOrder,
+		category.Rules,
+	).Scan(&category.ID)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return categoryNameConflict(ctx, s.db, category.Name)
+	}
+	return err
+}
+
+func (s *postgresStore) UpdateCategory(ctx context.Context, id int, category *Category) error {
+	var c categoryRow
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rules, err := categoryRules(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if (rules == nil) != (category.Rules == nil) {
+			return fmt.Errorf("%w: category %d cannot change between regular and smart", ErrConflict, id)
+		}
+		return tx.QueryRowContext(ctx, `
+			UPDATE categories c
+			SET name = $1, description = $2, color = NULLIF($3, ''), icon = $4, sort_order = $5, rules = $6
+			WHERE c.id = $7
+			RETURNING `+categoryColumns,
+			category.Name, category.Description, category.Color, category.Icon, category.SortOrder, category.Rules, id,
+		).Scan(c.dest()...)
+	})
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return categoryNameConflict(ctx, s.db, category.Name)
+	}
+	if err != nil {
+		return err
+	}
+	*category = c.category()
+	return nil
+}
+
+func (s *postgresStore) MoveCategory(ctx context.Context, id int, parentID *int) (Category, error) {
+	var category categoryRow
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockCategories(ctx, tx); err != nil {
+			return err
+		}
+		if parentID != nil {
+			for _, c := range []int{id, *parentID} {
+				rules, err := categoryRules(ctx, tx, c)
+				if err != nil {
+					return err
+				}
+				if rules != nil {
+					return smartCategoryConflict(c, "cannot have a parent or children")
+				}
+			}
+			var cycle bool
+			err := tx.QueryRowContext(ctx, `SELECT $1::int IN (`+categorySubtree("SELECT $2::int")+`)`,
+				*parentID, id).Scan(&cycle)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return fmt.Errorf("%w: category %d cannot be moved under itself or its descendant %d", ErrConflict, id, *parentID)
+			}
+		}
+		err := tx.QueryRowContext(ctx, "UPDATE categories c SET parent_id = $1 WHERE c.id = $2 RETURNING "+categoryColumns,
+			parentID, id).Scan(category.dest()...)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	})
+	return category.category(), err
+}
+
+func (s *postgresStore) MergeCategories(ctx context.Context, id, intoID int) (Category, error) {
+	var into categoryRow
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockCategories(ctx, tx); err != nil {
+			return err
+		}
+		var cycle bool
+		err := tx.QueryRowContext(ctx, `SELECT `+categoryColumns+`, c.id IN (`+categorySubtree("SELECT $2::int")+`)
+			FROM categories c WHERE c.id = $1`, intoID, id).Scan(append(into.dest(), &cycle)...)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return fmt.Errorf("%w: category %d cannot be merged into itself or its descendant %d", ErrConflict, id, intoID)
+		}
+		for _, c := range []int{id, intoID} {
+			rules, err := categoryRules(ctx, tx, c)
+			if err != nil {
+				return err
+			}
+			if rules != nil {
+				return smartCategoryConflict(c, "cannot be merged")
+			}
+		}
+		smart, err := rulesNaming(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		for _, c := range smart {
+			rules, err := mergedRules(c.ID, *c.Rules, id, intoID)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE categories SET rules = $1 WHERE id = $2", rules, c.ID); err != nil {
+				return err
+			}
+		}
+
+		// Movies in both categories keep a single link.
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO movie_categories (movie_id, category_id)
+			SELECT movie_id, $2 FROM movie_categories WHERE category_id = $1
+			ON CONFLICT DO NOTHING`, id, intoID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_categories WHERE category_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE categories SET parent_id = $2 WHERE parent_id = $1", id, intoID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return into.category(), err
+}
+
+func (s *postgresStore) DeleteCategory(ctx context.Context, id int, force bool) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// Locking the row holds off movies being added to the category.
+		var movies int
+		err := tx.QueryRowContext(ctx, `
+			SELECT (SELECT COUNT(*) FROM movie_categories mc WHERE mc.category_id = c.id)
+			FROM categories c
+			WHERE c.id = $1
+			FOR UPDATE`, id).Scan(&movies)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		smart, err := rulesNaming(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if len(smart) > 0 {
+			return categoryInRules(id, smart[0].ID)
+		}
+		if movies > 0 && !force {
+			return categoryInUse(id, movies)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_categories WHERE category_id = $1", id); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE categories
+			SET parent_id = (SELECT parent_id FROM categories WHERE id = $1)
+			WHERE parent_id = $1`, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", id)
+		return err
+	})
+}
+
+func (s *postgresStore) CleanupEmptyCategories(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM categories
+		WHERE id NOT IN (`+liveCategories(usedCategories+" UNION "+ruleCategories)+`) AND rules IS NULL`)
+	return err
+}
+
+func (s *postgresStore) ListTags(ctx context.Context) ([]Tag, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.id, t.name, COUNT(mt.movie_id)
+		FROM tags t
+		LEFT JOIN movie_tags mt ON mt.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY lower(t.name)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.MovieCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *postgresStore) RenameTag(ctx context.Context, id int, name string) (Tag, error) {
+	tag := Tag{ID: id}
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE tags SET name = $1 WHERE id = $2
+		RETURNING name, (SELECT COUNT(*) FROM movie_tags WHERE tag_id = $2)`,
+		name, id).Scan(&tag.Name, &tag.MovieCount)
+	if err == sql.ErrNoRows {
+		return tag, ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		var other int
+		if err := s.db.QueryRowContext(ctx, "SELECT id FROM tags WHERE lower(name) = lower($1)", name).Scan(&other); err != nil {
+			return tag, err
+		}
+		return tag, fmt.Errorf("%w: tag %q already exists as tag %d", ErrConflict, name, other)
+	}
+	return tag, err
+}
+
+func (s *postgresStore) MergeTags(ctx context.Context, id, intoID int) (Tag, error) {
+	into := Tag{ID: intoID}
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "SELECT name FROM tags WHERE id = $1 FOR UPDATE", intoID).Scan(&into.Name)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// Movies with both tags keep a single link.
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO movie_tags (movie_id, tag_id)
+			SELECT movie_id, $2 FROM movie_tags WHERE tag_id = $1
+			ON CONFLICT DO NOTHING`, id, intoID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_tags WHERE tag_id = $1", id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM movie_tags WHERE tag_id = $1", intoID).Scan(&into.MovieCount)
+	})
+	return into, err
+}
+
+func (s *postgresStore) DeleteTag(ctx context.Context, id int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM movie_tags WHERE tag_id = $1", id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// attachLinks loads the relations and collections of a single movie.
+func attachLinks(ctx context.Context, q queryer, movie *Movie) error {
+	rows, err := q.QueryContext(ctx, `
+		SELECT r.kind, TRUE, m.id, m.mid, m.title, COALESCE(m.year, 0)
+		FROM movie_relations r
+		JOIN movies m ON m.id = r.related_id
+		WHERE r.movie_id = $1
+		UNION ALL
+		SELECT r.kind, FALSE, m.id, m.mid, m.title, COALESCE(m.year, 0)
+		FROM movie_relations r
+		JOIN movies m ON m.id = r.movie_id
+		WHERE r.related_id = $1`, movie.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Relation
+		var outgoing bool
+		if err := rows.Scan(&r.Kind, &outgoing, &r.Movie.ID, &r.Movie.MID, &r.Movie.Title, &r.Movie.Year); err != nil {
+			return err
+		}
+		if !outgoing {
+			r.Kind = relationInverses[r.Kind]
+		}
+		movie.Relations = append(movie.Relations, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sortRelations(movie.Relations)
+
+	rows, err = q.QueryContext(ctx, `
+		SELECT c.id, c.name, cm.position
+		FROM collection_movies cm
+		JOIN collections c ON c.id = cm.collection_id
+		WHERE cm.movie_id = $1
+		ORDER BY lower(c.name)`, movie.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c CollectionRef
+		if err := rows.Scan(&c.ID, &c.Name, &c.Position); err != nil {
+			return err
+		}
+		movie.Collections = append(movie.Collections, c)
+	}
+	return rows.Err()
+}
+
+func (s *postgresStore) AddRelation(ctx context.Context, id int, kind string, relatedID int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// Concurrent additions could otherwise each close half of a cycle.
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE movie_relations IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+		if kind == "sequel_of" {
+			var cycle bool
+			err := tx.QueryRowContext(ctx, `
+				WITH RECURSIVE earlier(id) AS (
+					SELECT $1::int
+					UNION
+					SELECT r.related_id
+					FROM movie_relations r
+					JOIN earlier e ON r.movie_id = e.id
+					WHERE r.kind = 'sequel_of'
+				)
+				SELECT EXISTS (SELECT 1 FROM earlier WHERE id = $2)`, relatedID, id).Scan(&cycle)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return fmt.Errorf("%w: movie %d already precedes movie %d", ErrConflict, id, relatedID)
+			}
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO movie_relations (movie_id, kind, related_id) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`, id, kind, relatedID)
+		if isForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	})
+}
+
+func (s *postgresStore) RemoveRelation(ctx context.Context, id int, kind string, relatedID int) error {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM movie_relations WHERE movie_id = $1 AND kind = $2 AND related_id = $3", id, kind, relatedID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// attachCollectionMovies loads the movies of every collection in one query
+// and assigns them in place, in order.
+func attachCollectionMovies(ctx context.Context, q queryer, collections []Collection) error {
+	ids := make([]int64, len(collections))
+	index := make(map[int]int, len(collections))
+	for i := range collections {
+		ids[i] = int64(collections[i].ID)
+		index[collections[i].ID] = i
+		collections[i].Movies = []MovieRef{}
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT cm.collection_id, m.id, m.mid, m.title, COALESCE(m.year, 0)
+		FROM collection_movies cm
+		JOIN movies m ON m.id = cm.movie_id
+		WHERE cm.collection_id = ANY($1::int[])
+		ORDER BY cm.position`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var collectionID int
+		var m MovieRef
+		if err := rows.Scan(&collectionID, &m.ID, &m.MID, &m.Title, &m.Year); err != nil {
+			return err
+		}
+		c := &collections[index[collectionID]]
+		c.Movies = append(c.Movies, m)
+	}
+	return rows.Err()
+}
+
+// setCollectionMovies replaces the movies of a collection, numbering their
+// positions from 1.
+func setCollectionMovies(ctx context.Context, tx *sql.Tx, id int, movieIDs []int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM collection_movies WHERE collection_id = $1", id); err != nil {
+		return err
+	}
+	for i, movieID := range movieIDs {
+		_, err := tx.ExecContext(ctx, "INSERT INTO collection_movies (collection_id, movie_id, position) VALUES ($1, $2, $3)",
+			id, movieID, i+1)
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("%w: movie %d", ErrNotFound, movieID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectionNameConflict returns the conflict of a collection with a name
+// that is already taken.
+func collectionNameConflict(name string) error {
+	return fmt.Errorf("%w: collection %q already exists", ErrConflict, name)
+}
+
+func (s *postgresStore) ListCollections(ctx context.Context) ([]Collection, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, description FROM collections ORDER BY lower(name)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		var c Collection
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return collections, attachCollectionMovies(ctx, s.db, collections)
+}
+
+func (s *postgresStore) GetCollection(ctx context.Context, id int) (Collection, error) {
+	c := Collection{ID: id}
+	err := s.db.QueryRowContext(ctx, "SELECT name, description FROM collections WHERE id = $1", id).
+		Scan(&c.Name, &c.Description)
+	if err == sql.ErrNoRows {
+		return c, ErrNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	collections := []Collection{c}
+	err = attachCollectionMovies(ctx, s.db, collections)
+	return collections[0], err
+}
+
+func (s *postgresStore) CreateCollection(ctx context.Context, c *Collection, movieIDs []int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, "INSERT INTO collections (name, description) VALUES ($1, $2) RETURNING id",
+			c.Name, c.Description).Scan(&c.ID)
+		if isUniqueViolation(err) {
+			return collectionNameConflict(c.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if err := setCollectionMovies(ctx, tx, c.ID, movieIDs); err != nil {
+			return err
+		}
+		collections := []Collection{*c}
+		if err := attachCollectionMovies(ctx, tx, collections); err != nil {
+			return err
+		}
+		*c = collections[0]
+		return nil
+	})
+}
+
+func (s *postgresStore) UpdateCollection(ctx context.Context, id int, c *Collection, movieIDs []int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "UPDATE collections SET name = $1, description = $2 WHERE id = $3",
+			c.Name, c.Description, id)
+		if isUniqueViolation(err) {
+			return collectionNameConflict(c.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		if err := setCollectionMovies(ctx, tx, id, movieIDs); err != nil {
+			return err
+		}
+		c.ID = id
+		collections := []Collection{*c}
+		if err := attachCollectionMovies(ctx, tx, collections); err != nil {
+			return err
+		}
+		*c = collections[0]
+		return nil
+	})
+}
+
+func (s *postgresStore) DeleteCollection(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM collections WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *postgresStore) Autocomplete(ctx context.Context, req AutocompleteRequest) (Autocompletion, error) {
+	result := make(Autocompletion)
+	prefix := likePrefix(strings.ToLower(req.Prefix))
+	wordPrefix := "% " + likePrefix(req.Prefix)
+
+	// Names starting with the prefix come before those with a later word
+	// starting with it; after that movies rank by recency and directors
+	// and categories by how many movies they have.
+	queries := []struct {
+		kind  string
+		query string
+		args  []interface{}
+	}{
+		{"movie", `
+			SELECT id, title, COALESCE(year, 0), 0
+			FROM movies
+			WHERE lower(title) LIKE $1 OR title ILIKE $2
+			ORDER BY lower(title) LIKE $1 DESC, created_at DESC, id DESC
+			LIMIT $3`, []interface{}{prefix, wordPrefix, req.Limit}},
+		{"director", `
+			SELECT d.id, d.firstname || ' ' || d.lastname, 0, movies
+			FROM people d
+			JOIN LATERAL (
+				SELECT COUNT(*) AS movies FROM movie_credits mc
+				WHERE mc.person_id = d.id AND mc.role = 'director'
+			) credits ON movies > 0
+			WHERE (lower(d.firstname) LIKE $1
+				OR lower(d.lastname) LIKE $1
+				OR (d.firstname || ' ' || d.lastname) ILIKE $2)
+			ORDER BY lower(d.firstname) LIKE $1 DESC, movies DESC, d.lastname, d.firstname
+			LIMIT $3`, []interface{}{prefix, likePrefix(req.Prefix), req.Limit}},
+		{"category", `
+			SELECT c.id, c.name, 0,
+				(SELECT COUNT(*) FROM movie_categories mc WHERE mc.category_id = c.id) AS movies
+			FROM categories c
+			WHERE lower(c.name) LIKE $1 OR c.name ILIKE $2
+			ORDER BY lower(c.name) LIKE $1 DESC, movies DESC, c.name
+			LIMIT $3`, []interface{}{prefix, wordPrefix, req.Limit}},
+	}
+
+	for _, q := range queries {
+		if !req.Types[q.kind] {
+			continue
+		}
+		rows, err := s.db.QueryContext(ctx, q.query, q.args...)
+		if err != nil {
+			return result, err
+		}
+		items := []AutocompleteItem{}
+		for rows.Next() {
+			var item AutocompleteItem
+			if err := rows.Scan(&item.ID, &item.Label, &item.Year, &item.Count); err != nil {
+				rows.Close()
+				return result, err
+			}
+			items = append(items, item)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+		result[q.kind] = items
+	}
+	return result, nil
+}
+
+// userColumns selects a user from users u, including their roles.
+const userColumns = `u.id, u.username, u.created_at,
+	COALESCE((SELECT array_agg(ur.role) FROM user_roles ur WHERE ur.user_id = u.id), '{}')`
+
+func userDest(u *User) []interface{} {
+	return []interface{}{&u.ID, &u.Username, &u.CreatedAt, pq.Array(&u.Roles)}
+}
+
+// queryUser returns the single user selected by query, with ErrNotFound
+// if there is none.
+func queryUser(ctx context.Context, q queryer, query string, args ...interface{}) (User, error) {
+	var user User
+	err := q.QueryRowContext(ctx, query, args...).Scan(userDest(&user)...)
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+	sortRoles(user.Roles)
+	return user, err
+}
+
+// insertUser stores a new user, with a password hash or an OIDC issuer and
+// subject.
+func insertUser(ctx context.Context, tx *sql.Tx, username string, passwordHash, issuer, subject *string) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO users (username, password_hash, oidc_issuer, oidc_subject) VALUES ($1, $2, $3, $4)
+		RETURNING id`, username, passwordHash, issuer, subject).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("%w: username %q is taken", ErrConflict, username)
+	}
+	return id, err
+}
+
+func (s *postgresStore) CreateUser(ctx context.Context, user *User, passwordHash string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := insertUser(ctx, tx, user.Username, &passwordHash, nil, nil)
+		if err != nil {
+			return err
+		}
+		*user, err = queryUser(ctx, tx, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", id)
+		return err
+	})
+}
+
+func (s *postgresStore) OIDCUser(ctx context.Context, issuer, subject, username string) (User, error) {
+	var user User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE oidc_issuer = $1 AND oidc_subject = $2",
+			issuer, subject).Scan(&id)
+		if err == sql.ErrNoRows {
+			id, err = insertUser(ctx, tx, username, nil, &issuer, &subject)
+		}
+		if err != nil {
+			return err
+		}
+		user, err = queryUser(ctx, tx, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", id)
+		return err
+	})
+	return user, err
+}
+
+func (s *postgresStore) SyncOIDCRoles(ctx context.Context, userID int, roles []string) (User, error) {
+	var user User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Keeps the last admins from losing the role at once, as in
+		// RevokeRole.
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE user_roles IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+		if _, err := queryUser(ctx, tx, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", userID); err != nil {
+			return err
+		}
+		for _, role := range roles {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO user_roles (user_id, role, from_oidc) VALUES ($1, $2, true)
+				ON CONFLICT DO NOTHING`, userID, role)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM user_roles
+			WHERE user_id = $1 AND from_oidc AND NOT role = ANY($2)
+				AND (role <> 'admin' OR EXISTS (
+					SELECT 1 FROM user_roles o WHERE o.role = 'admin' AND o.user_id <> $1))`,
+			userID, pq.Array(roles))
+		if err != nil {
+			return err
+		}
+		user, err = queryUser(ctx, tx, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", userID)
+		return err
+	})
+	return user, err
+}
+
+func (s *postgresStore) UserByName(ctx context.Context, username string) (User, string, error) {
+	var user User
+	var hash string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT `+userColumns+`, COALESCE(u.password_hash, '') FROM users u WHERE lower(u.username) = lower($1)`,
+		username).Scan(append(userDest(&user), &hash)...)
+	if err == sql.ErrNoRows {
+		return user, "", ErrNotFound
+	}
+	sortRoles(user.Roles)
+	return user, hash, err
+}
+
+func (s *postgresStore) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users u ORDER BY lower(u.username)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(userDest(&u)...); err != nil {
+			return nil, err
+		}
+		sortRoles(u.Roles)
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *postgresStore) GetUser(ctx context.Context, id int) (User, error) {
+	return queryUser(ctx, s.db, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", id)
+}
+
+func (s *postgresStore) GrantRole(ctx context.Context, userID int, role string) (User, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_roles (user_id, role) VALUES ($1, $2)
+		ON CONFLICT (user_id, role) DO UPDATE SET from_oidc = false`,
+		userID, role)
+	if isForeignKeyViolation(err) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return queryUser(ctx, s.db, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", userID)
+}
+
+func (s *postgresStore) RevokeRole(ctx context.Context, userID int, role string) (User, error) {
+	var user User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Keeps two admins from revoking each other at once.
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE user_roles IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+		var err error
+		if user, err = queryUser(ctx, tx, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", userID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role = $2", userID, role)
+		if err != nil {
+			return err
+		}
+		// Revoking a role the user lacks changes nothing.
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		if role == roleAdmin {
+			var admins int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_roles WHERE role = 'admin'").Scan(&admins); err != nil {
+				return err
+			}
+			if admins == 0 {
+				return fmt.Errorf("%w: user %d is the last admin", ErrConflict, userID)
+			}
+		}
+		user, err = queryUser(ctx, tx, "SELECT "+userColumns+" FROM users u WHERE u.id = $1", userID)
+		return err
+	})
+	return user, err
+}
+
+func (s *postgresStore) CreateSession(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1 AND expires_at <= now()", userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+			tokenHash, userID, expiresAt)
+		if isForeignKeyViolation(err) {
+			return ErrNotFound
+		}
+		return err
+	})
+}
+
+func (s *postgresStore) SessionUser(ctx context.Context, tokenHash string) (User, error) {
+	return queryUser(ctx, s.db, `
+		SELECT `+userColumns+`
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > now()`, tokenHash)
+}
+
+func (s *postgresStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash = $1", tokenHash)
+	return err
+}
+
+const apiKeyColumns = "id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at"
+
+// apiKeyRow scans an API key, whose nullable columns need converting.
+type apiKeyRow struct {
+	APIKey
+	createdBy  sql.NullInt64
+	expiresAt  sql.NullTime
+	lastUsedAt sql.NullTime
+}
+
+func (k *apiKeyRow) dest() []interface{} {
+	return []interface{}{&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.createdBy, &k.CreatedAt,
+		&k.expiresAt, &k.lastUsedAt}
+}
+
+func (k *apiKeyRow) apiKey() APIKey {
+	key := k.APIKey
+	key.CreatedBy = nullableID(k.createdBy)
+	key.ExpiresAt = nullableTime(k.expiresAt)
+	key.LastUsedAt = nullableTime(k.lastUsedAt)
+	return key
+}
+
+// nullableTime converts a nullable timestamp column to a pointer.
+func nullableTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (s *postgresStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k apiKeyRow
+		if err := rows.Scan(k.dest()...); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k.apiKey())
+	}
+	return keys, rows.Err()
+}
+
+func (s *postgresStore) CreateAPIKey(ctx context.Context, key *APIKey, hash string) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.CreatedBy, key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *postgresStore) DeleteAPIKey(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *postgresStore) UseAPIKey(ctx context.Context, hash string) (APIKey, error) {
+	var k apiKeyRow
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE api_keys SET last_used_at = now()
+		WHERE key_hash = $1 AND (expires_at IS NULL OR expires_at > now())
+		RETURNING `+apiKeyColumns, hash).Scan(k.dest()...)
+	if err == sql.ErrNoRows {
+		return APIKey{}, ErrNotFound
+	}
+	return k.apiKey(), err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestMovieStore(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		ctx := context.Background()
+		store := ts.store
+
+		movie := testMovie("Alien", 1979)
+		movie.MID = generateMID(movie)
+		movie.Categories = []Category{{Name: "Horror"}}
+		if err := store.CreateMovie(ctx, &movie); err != nil {
+			t.Fatal(err)
+		}
+		id, err := strconv.Atoi(movie.ID)
+		if err != nil {
+			t.Fatalf("created movie has id %q", movie.ID)
+		}
+
+		got, err := store.GetMovie(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "Alien" || got.Director.Lastname != "Scott" || len(got.Categories) != 1 || got.Categories[0].Name != "Horror" {
+			t.Errorf("GetMovie = %+v", got)
+		}
+
+		update := testMovie("Alien: Director's Cut", 1979)
+		if err := store.UpdateMovie(ctx, id, &update); err != nil {
+			t.Fatal(err)
+		}
+		if update.MID != movie.MID {
+			t.Errorf("MID changed from %q to %q", movie.MID, update.MID)
+		}
+		page, err := store.ListMovies(ctx, ListOptions{Sort: "title"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 1 || len(page.Movies) != 1 || page.Movies[0].Title != update.Title || len(page.Movies[0].Categories) != 0 {
+			t.Errorf("ListMovies = %+v", page)
+		}
+
+		categories, err := store.ListCategories(ctx, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(categories) != 1 || categories[0].Name != "Horror" || *categories[0].MovieCount != 0 {
+			t.Errorf("ListCategories = %+v", categories)
+		}
+
+		if err := store.DeleteMovie(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetMovie(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetMovie after delete: err = %v, want ErrNotFound", err)
+		}
+		if err := store.DeleteMovie(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second delete: err = %v, want ErrNotFound", err)
+		}
+		if err := store.UpdateMovie(ctx, id, &update); !errors.Is(err, ErrNotFound) {
+			t.Errorf("update after delete: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// TestReadHandlers serves movies put in the store directly, as anyone may
+// read them.
+func TestReadHandlers(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	movie := testMovie("Alien", 1979)
+	movie.MID = generateMID(movie)
+	movie.Categories = []Category{{Name: "Horror"}}
+	if err := ts.store.CreateMovie(ctx, &movie); err != nil {
+		t.Fatal(err)
+	}
+
+	var list []Movie
+	ts.expect(ts.do("GET", "/movies", "", nil), http.StatusOK, &list)
+	if len(list) != 1 || list[0].ID != movie.ID {
+		t.Errorf("GET /movies = %+v", list)
+	}
+	var got Movie
+	ts.expect(ts.do("GET", "/movies/"+movie.ID, "", nil), http.StatusOK, &got)
+	if got.Title != "Alien" || got.MID != movie.MID {
+		t.Errorf("GET /movies/%s = %+v", movie.ID, got)
+	}
+	ts.expect(ts.do("GET", "/movies/999", "", nil), http.StatusNotFound, nil)
+	ts.expect(ts.do("GET", "/movies/abc", "", nil), http.StatusBadRequest, nil)
+
+	var categories []Category
+	ts.expect(ts.do("GET", "/categories?flat=true", "", nil), http.StatusOK, &categories)
+	if len(categories) != 1 || categories[0].Name != "Horror" {
+		t.Fatalf("GET /categories = %+v", categories)
+	}
+	var movies []Movie
+	ts.expect(ts.do("GET", categoryPath(categories[0].ID, "/movies"), "", nil), http.StatusOK, &movies)
+	if len(movies) != 1 || movies[0].ID != movie.ID {
+		t.Errorf("category movies = %+v", movies)
+	}
+}
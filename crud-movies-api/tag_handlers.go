@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// getTags lists every tag with the number of movies carrying it.
+func (s *server) getTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.store.ListTags(r.Context())
+	if err != nil {
+		log.Printf("Error fetching tags: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// renameTag renames tag {id}. Taking another tag's name, in any case, is a
+// conflict; merge the tags instead.
+func (s *server) renameTag(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid tag id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := cleanTagName(body.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tag, err := s.store.RenameTag(r.Context(), id, name)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error renaming tag: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tag)
+}
+
+// mergeTag folds tag {id} into tag {target}: the target takes over its
+// movies and {id} is deleted.
+func (s *server) mergeTag(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid tag id", http.StatusBadRequest)
+		return
+	}
+	target, err := strconv.Atoi(mux.Vars(r)["target"])
+	if err != nil {
+		http.Error(w, "Invalid target tag id", http.StatusBadRequest)
+		return
+	}
+	if id == target {
+		http.Error(w, "Cannot merge a tag into itself", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := s.store.MergeTags(r.Context(), id, target)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error merging tag %d into %d: %v", id, target, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tag)
+}
+
+// deleteTag takes a tag off every movie and deletes it.
+func (s *server) deleteTag(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r)
+	if err != nil {
+		http.Error(w, "Invalid tag id", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.DeleteTag(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting tag: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Tag deleted successfully"})
+}
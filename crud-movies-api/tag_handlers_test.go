@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// tagCounts returns the movie count of every tag by name.
+func (ts *testServer) tagCounts() map[string]int {
+	ts.t.Helper()
+	var tags []Tag
+	ts.expect(ts.do("GET", "/tags", "", nil), http.StatusOK, &tags)
+	counts := make(map[string]int)
+	for _, tag := range tags {
+		counts[tag.Name] = tag.MovieCount
+	}
+	return counts
+}
+
+func tagPath(id int, rest string) string {
+	return "/tags/" + strconv.Itoa(id) + rest
+}
+
+func TestTags(t *testing.T) {
+	eachStore(t, func(t *testing.T, ts *testServer) {
+		admin := ts.login("admin", roleAdmin)
+
+		var aliens Movie
+		for _, m := range []struct {
+			title string
+			tags  []string
+		}{
+			{"Alien", []string{"horror", "space"}},
+			{"Aliens", []string{"action", "outer space", "Space", "  outer   SPACE "}},
+			{"Sunshine", []string{"outer space"}},
+		} {
+			movie := testMovie(m.title, 1979)
+			movie.Tags = m.tags
+			created := ts.createMovie(admin, movie)
+			if m.title == "Aliens" {
+				aliens = created
+			}
+		}
+		if want := []string{"action", "outer space", "space"}; !reflect.DeepEqual(aliens.Tags, want) {
+			t.Errorf("Aliens' tags = %q, want %q", aliens.Tags, want)
+		}
+		if want := map[string]int{"action": 1, "horror": 1, "outer space": 2, "space": 2}; !reflect.DeepEqual(ts.tagCounts(), want) {
+			t.Errorf("tags = %v, want %v", ts.tagCounts(), want)
+		}
+
+		var tags []Tag
+		ts.expect(ts.do("GET", "/tags", "", nil), http.StatusOK, &tags)
+		ids := make(map[string]int)
+		for _, tag := range tags {
+			ids[tag.Name] = tag.ID
+		}
+		space, outer := ids["space"], ids["outer space"]
+
+		// Renaming to another tag's name, in any case, is a conflict; a tag
+		// may change its own case.
+		ts.expect(ts.do("PUT", tagPath(outer, ""), admin, map[string]string{"name": "SPACE"}), http.StatusConflict, nil)
+		ts.expect(ts.do("PUT", tagPath(outer, ""), admin, map[string]string{"name": " "}), http.StatusBadRequest, nil)
+		var renamed Tag
+		ts.expect(ts.do("PUT", tagPath(space, ""), admin, map[string]string{"name": "Space"}), http.StatusOK, &renamed)
+		if renamed.ID != space || renamed.Name != "Space" || renamed.MovieCount != 2 {
+			t.Errorf("renamed = %+v", renamed)
+		}
+
+		// Merging moves the movies, keeping one tag on movies having both.
+		ts.expect(ts.do("POST", tagPath(outer, "/merge-into/"+strconv.Itoa(outer)), admin, nil), http.StatusBadRequest, nil)
+		ts.expect(ts.do("POST", tagPath(outer, "/merge-into/999"), admin, nil), http.StatusNotFound, nil)
+		var merged Tag
+		ts.expect(ts.do("POST", tagPath(outer, "/merge-into/"+strconv.Itoa(space)), admin, nil), http.StatusOK, &merged)
+		if merged.ID != space || merged.MovieCount != 3 {
+			t.Errorf("merged = %+v, want tag %d on 3 movies", merged, space)
+		}
+		if want := map[string]int{"action": 1, "horror": 1, "Space": 3}; !reflect.DeepEqual(ts.tagCounts(), want) {
+			t.Errorf("tags after the merge = %v, want %v", ts.tagCounts(), want)
+		}
+		var movie Movie
+		ts.expect(ts.do("GET", "/movies/"+aliens.ID, "", nil), http.StatusOK, &movie)
+		if want := []string{"action", "Space"}; !reflect.DeepEqual(movie.Tags, want) {
+			t.Errorf("Aliens' tags after the merge = %q, want %q", movie.Tags, want)
+		}
+
+		ts.expect(ts.do("DELETE", tagPath(space, ""), admin, nil), http.StatusOK, nil)
+		if want := map[string]int{"action": 1, "horror": 1}; !reflect.DeepEqual(ts.tagCounts(), want) {
+			t.Errorf("tags after the delete = %v, want %v", ts.tagCounts(), want)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxTagLength = 50
+
+// cleanTagName trims a tag name and collapses its inner whitespace.
+func cleanTagName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("tags cannot be blank")
+	}
+	if len([]rune(name)) > maxTagLength {
+		return "", fmt.Errorf("tags must be at most %d characters", maxTagLength)
+	}
+	return name, nil
+}
+
+// normalizeTags cleans the movie's tags, drops those repeating an earlier
+// one regardless of case, and sorts them the way stores return them.
+func normalizeTags(movie *Movie) error {
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, t := range movie.Tags {
+		t, err := cleanTagName(t)
+		if err != nil {
+			return err
+		}
+		if key := strings.ToLower(t); !seen[key] {
+			seen[key] = true
+			tags = append(tags, t)
+		}
+	}
+	sortTags(tags)
+	movie.Tags = tags
+	return nil
+}
+
+// sortTags orders tag names case-insensitively.
+func sortTags(tags []string) {
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+}
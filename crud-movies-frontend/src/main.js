@@ -1,5 +1,7 @@
 import { createApp } from "vue";
 import App from "./App.vue";
 import router from "./router";
+import { installAuth } from "./services/auth";
 
+installAuth(router);
 createApp(App).use(router).mount("#app");
@@ -3,17 +3,30 @@ import MovieList from "../components/MovieList.vue";
 import MovieForm from "../components/MovieForm.vue";
 import CategoryList from "../views/CategoryList.vue";
 import CategoryMovies from "../views/CategoryMovies.vue";
+import LoginView from "../views/LoginView.vue";
+import { auth } from "../services/auth";
 
 const routes = [
   { path: "/", name: "Home", component: MovieList },
-  { path: "/add", name: "AddMovie", component: MovieForm },
-  { path: "/edit/:id", name: "EditMovie", component: MovieForm },
+  {
+    path: "/add",
+    name: "AddMovie",
+    component: MovieForm,
+    meta: { requiresAuth: true },
+  },
+  {
+    path: "/edit/:id",
+    name: "EditMovie",
+    component: MovieForm,
+    meta: { requiresAuth: true },
+  },
   { path: "/categories", name: "CategoryList", component: CategoryList },
   {
     path: "/categories/:id/movies",
     name: "CategoryMovies",
     component: CategoryMovies,
   },
+  { path: "/login", name: "Login", component: LoginView },
 ];
 
 const router = createRouter({
@@ -21,4 +34,11 @@ const router = createRouter({
   routes,
 });
 
+// Pages that change movies send visitors to log in first.
+router.beforeEach((to) => {
+  if (to.meta.requiresAuth && !auth.session) {
+    return { name: "Login", query: { redirect: to.fullPath } };
+  }
+});
+
 export default router;
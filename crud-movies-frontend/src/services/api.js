@@ -22,8 +22,12 @@ export default {
   async deleteMovie(id) {
     await axios.delete(`${API_URL}/movies/${id}`);
   },
-  async searchMovies(query) {
-    const response = await axios.get(`${API_URL}/movies/search?q=${query}`);
-    return response.data;
+  // searchMovies resolves to the search envelope:
+  // { results, total, next_cursor, suggestions, facets }.
+  async searchMovies(query, params = {}) {
+    const response = await axios.get(`${API_URL}/movies/search`, {
+      params: { ...params, q: query },
+    });
+    return { suggestions: [], ...response.data, results: response.data.results || [] };
   },
 };
@@ -0,0 +1,86 @@
+import axios from "axios";
+import { reactive } from "vue";
+
+const API_URL = "http://localhost:8000";
+const STORAGE_KEY = "session";
+
+// auth holds the logged-in session, { token, expires_at, user }, or null.
+// It is kept in localStorage so that a reload stays logged in.
+export const auth = reactive({ session: loadSession() });
+
+function loadSession() {
+  try {
+    const session = JSON.parse(localStorage.getItem(STORAGE_KEY));
+    if (session && new Date(session.expires_at) > new Date()) {
+      return session;
+    }
+  } catch (error) {
+    // A corrupt entry is treated as no session.
+  }
+  localStorage.removeItem(STORAGE_KEY);
+  return null;
+}
+
+function setSession(session) {
+  auth.session = session;
+  if (session) {
+    localStorage.setItem(STORAGE_KEY, JSON.stringify(session));
+  } else {
+    localStorage.removeItem(STORAGE_KEY);
+  }
+}
+
+export async function login(username, password) {
+  const response = await axios.post(`${API_URL}/auth/login`, {
+    username,
+    password,
+  });
+  setSession(response.data);
+  return response.data.user;
+}
+
+export async function logout() {
+  try {
+    await axios.post(`${API_URL}/auth/logout`);
+  } finally {
+    setSession(null);
+  }
+}
+
+// hasRole reports whether the logged-in user holds role or a more
+// privileged one, as the API's policy does.
+export function hasRole(role) {
+  const ranks = { viewer: 0, editor: 1, admin: 2 };
+  if (!auth.session) {
+    return false;
+  }
+  return ["viewer", ...auth.session.user.roles].some(
+    (r) => ranks[r] >= ranks[role]
+  );
+}
+
+// installAuth sends the session token with every axios request and, when
+// the API rejects it, drops the session and asks the user to log in.
+export function installAuth(router) {
+  axios.interceptors.request.use((config) => {
+    if (auth.session) {
+      config.headers.Authorization = `Bearer ${auth.session.token}`;
+    }
+    return config;
+  });
+  axios.interceptors.response.use(undefined, (error) => {
+    const url = error.config ? error.config.url : "";
+    if (
+      error.response &&
+      error.response.status === 401 &&
+      !url.startsWith(`${API_URL}/auth/`)
+    ) {
+      setSession(null);
+      router.push({
+        name: "Login",
+        query: { redirect: router.currentRoute.value.fullPath },
+      });
+    }
+    return Promise.reject(error);
+  });
+}